@@ -0,0 +1,82 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"strconv"
+)
+
+// reportTemplate is the HTML report: summary charts, then one section per
+// input file with its per-node chart and metadata. Charts are inlined, so
+// the file has no external references.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h2 { border-bottom: 1px solid #ccc; padding-bottom: .2em; }
+svg { max-width: 100%; height: auto; }
+table { border-collapse: collapse; font-size: 13px; margin: 1em 0 2em; }
+td { border: 1px solid #ddd; padding: 2px 8px; }
+td:first-child { font-family: monospace; }
+.files { columns: 2; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{len .Files}} result file(s):</p>
+<ul class="files">{{range .Files}}<li><a href="#{{.Anchor}}">{{.Path}}</a></li>{{end}}</ul>
+{{if .Summary}}<h2>Summary</h2>
+{{range .Summary}}<figure>{{.}}</figure>
+{{end}}{{end}}
+{{range .Files}}<h2 id="{{.Anchor}}">{{.Path}}</h2>
+{{if .Chart}}<figure>{{.Chart}}</figure>
+{{end}}<table>
+{{range .Meta}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+type htmlFile struct {
+	Anchor string
+	Path   string
+	Chart  template.HTML
+	Meta   []struct{ Key, Value string }
+}
+
+// writeHTML writes the report to path.
+func writeHTML(path string, rep report) error {
+	data := struct {
+		Title   string
+		Summary []template.HTML
+		Files   []htmlFile
+	}{Title: rep.title}
+	for _, c := range rep.summary {
+		// the SVG is generated here with every text node escaped
+		data.Summary = append(data.Summary, template.HTML(c.chart.svg()))
+	}
+	for i, s := range rep.sections {
+		f := htmlFile{Anchor: "file-" + strconv.Itoa(i), Path: s.result.path}
+		if s.chart != nil {
+			f.Chart = template.HTML(s.chart.chart.svg())
+		}
+		for _, p := range s.result.meta {
+			f.Meta = append(f.Meta, struct{ Key, Value string }{p.key, p.value})
+		}
+		data.Files = append(data.Files, f)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(out, data); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
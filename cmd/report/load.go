@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// result is one simulator output file in the CSV layout: a header, data
+// rows and "#key,value" metadata, whichever -format wrote it.
+type result struct {
+	path    string
+	name    string // file name without directory and extension
+	columns []string
+	rows    [][]string
+	meta    []pair // config then summary rows, in file order
+	lookup  map[string]string
+}
+
+type pair struct{ key, value string }
+
+func (r *result) get(key string) (string, bool) {
+	v, ok := r.lookup[key]
+	return v, ok
+}
+
+// column returns the index of the named column, or -1.
+func (r *result) column(name string) int {
+	for i, c := range r.columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *result) mode() string {
+	if m, ok := r.get("mode"); ok {
+		return m
+	}
+	return ""
+}
+
+func (r *result) addMeta(key, value string) {
+	r.meta = append(r.meta, pair{key, value})
+	r.lookup[key] = value
+}
+
+// loadResult reads a simulator output file written with -format csv, json
+// or ndjson; the format is detected from the first character.
+func loadResult(path string) (*result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(path)
+	r := &result{
+		path:   path,
+		name:   strings.TrimSuffix(base, filepath.Ext(base)),
+		lookup: make(map[string]string),
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		err = errors.New("empty file")
+	case trimmed[0] != '{':
+		err = r.readCSV(data)
+	case bytes.Contains(trimmed, []byte("\n{")):
+		err = r.readNDJSON(trimmed)
+	default:
+		err = r.readJSON(trimmed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *result) readCSV(data []byte) error {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(rec) > 0 && strings.HasPrefix(rec[0], "#"):
+			var v string
+			if len(rec) > 1 {
+				v = rec[1]
+			}
+			r.addMeta(strings.TrimPrefix(rec[0], "#"), v)
+		case r.columns == nil:
+			r.columns = rec
+		default:
+			r.rows = append(r.rows, rec)
+		}
+	}
+}
+
+// readJSON reads a -format json document.
+func (r *result) readJSON(data []byte) error {
+	var doc struct {
+		Columns []string          `json:"columns"`
+		Config  json.RawMessage   `json:"config"`
+		Rows    []json.RawMessage `json:"rows"`
+		Summary json.RawMessage   `json:"summary"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	r.columns = doc.Columns
+	for _, obj := range []json.RawMessage{doc.Config, doc.Summary} {
+		if err := r.readMeta(obj); err != nil {
+			return err
+		}
+	}
+	for _, row := range doc.Rows {
+		if err := r.readRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readNDJSON reads -format ndjson records.
+func (r *result) readNDJSON(data []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var rec struct {
+			Record  string          `json:"record"`
+			Columns []string        `json:"columns"`
+			Config  json.RawMessage `json:"config"`
+			Row     json.RawMessage `json:"row"`
+			Summary json.RawMessage `json:"summary"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		var err error
+		switch rec.Record {
+		case "config":
+			r.columns = rec.Columns
+			err = r.readMeta(rec.Config)
+		case "row":
+			err = r.readRow(rec.Row)
+		case "summary":
+			err = r.readMeta(rec.Summary)
+		default:
+			err = fmt.Errorf("unknown record %q", rec.Record)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return sc.Err()
+}
+
+func (r *result) readMeta(obj json.RawMessage) error {
+	pairs, err := objectPairs(obj)
+	if err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		r.addMeta(p.key, p.value)
+	}
+	return nil
+}
+
+func (r *result) readRow(obj json.RawMessage) error {
+	pairs, err := objectPairs(obj)
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		byKey[p.key] = p.value
+	}
+	row := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		row[i] = byKey[c]
+	}
+	r.rows = append(r.rows, row)
+	return nil
+}
+
+// objectPairs returns the members of a flat JSON object in order, with
+// values formatted as they would appear in the CSV (null as "").
+func objectPairs(obj json.RawMessage) ([]pair, error) {
+	if len(obj) == 0 || string(obj) == "null" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("expected a JSON object")
+	}
+	var out []pair
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := t.(string)
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		var s string
+		switch v := v.(type) {
+		case nil:
+		case string:
+			s = v
+		case json.Number:
+			s = v.String()
+		case bool:
+			s = fmt.Sprintf("%t", v)
+		default:
+			return nil, fmt.Errorf("%s: nested values are not supported", key)
+		}
+		out = append(out, pair{key, s})
+	}
+	return out, nil
+}
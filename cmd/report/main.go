@@ -0,0 +1,307 @@
+// Command report renders the simulator's output files as SVG charts and a
+// self-contained HTML report, replacing scripts/plot_results.py and
+// scripts/plot_churn.py:
+//
+//	go run ./cmd/report -outdir plots results/*.csv
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	outDir := flag.String("outdir", "plots", "directory for the SVG charts and the HTML report")
+	htmlName := flag.String("html", "report.html", "HTML report file name in -outdir (empty = no report)")
+	title := flag.String("title", "Consistent hashing simulation report", "HTML report title")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: report [flags] result.csv|json|ndjson ...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var results []*result
+	for _, path := range flag.Args() {
+		r, err := loadResult(path)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		results = append(results, r)
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatalf("create output directory: %v", err)
+	}
+	rep := buildReport(*title, results)
+	for _, c := range rep.charts() {
+		path := filepath.Join(*outDir, c.file)
+		if err := os.WriteFile(path, []byte(c.chart.svg()), 0o644); err != nil {
+			log.Fatalf("write chart: %v", err)
+		}
+		log.Printf("[OK] Wrote %s", path)
+	}
+	if *htmlName != "" {
+		path := filepath.Join(*outDir, *htmlName)
+		if err := writeHTML(path, rep); err != nil {
+			log.Fatalf("write report: %v", err)
+		}
+		log.Printf("[OK] Wrote %s", path)
+	}
+}
+
+// namedChart is a chart and the SVG file it is written to.
+type namedChart struct {
+	file  string
+	chart barChart
+}
+
+// fileSection is the part of the report about one input file.
+type fileSection struct {
+	result *result
+	chart  *namedChart // per-node chart, if the file has per-node rows
+}
+
+type report struct {
+	title    string
+	summary  []namedChart
+	sections []fileSection
+}
+
+func (r report) charts() []namedChart {
+	out := append([]namedChart(nil), r.summary...)
+	for _, s := range r.sections {
+		if s.chart != nil {
+			out = append(out, *s.chart)
+		}
+	}
+	return out
+}
+
+// summaryStats are the distribution metrics compared across dist runs, in
+// the order and with the file names of scripts/plot_results.py.
+var summaryStats = []struct{ key, file string }{
+	{"cv", "summary_cv_vs_algo.svg"},
+	{"max_avg", "summary_maxoveravg_vs_algo.svg"},
+	{"gini", "summary_gini_vs_algo.svg"},
+	{"jain", "summary_jain_vs_algo.svg"},
+	{"kl_uniform", "summary_kl_uniform_vs_algo.svg"},
+}
+
+func buildReport(title string, results []*result) report {
+	rep := report{title: title}
+	used := make(map[string]bool)
+	for _, r := range results {
+		sec := fileSection{result: r}
+		if c, ok := perNodeChart(r); ok {
+			if used[c.file] {
+				c.file = "per_node_" + r.name + ".svg"
+			}
+			used[c.file] = true
+			sec.chart = &c
+		}
+		rep.sections = append(rep.sections, sec)
+	}
+
+	var dist, churn []*result
+	for _, r := range results {
+		switch r.mode() {
+		case "dist":
+			dist = append(dist, r)
+		case "churn":
+			churn = append(churn, r)
+		}
+	}
+	for _, st := range summaryStats {
+		if c, ok := compareChart(dist, st.key, distStat(st.key)); ok {
+			rep.summary = append(rep.summary, namedChart{st.file, c})
+		}
+	}
+	if c, ok := compareChart(churn, "moved_ratio", metaFloat("moved_ratio")); ok {
+		if ops := distinct(churn, "churn_op"); len(ops) == 1 {
+			c.title = fmt.Sprintf("Fraction of keys moved vs algorithm (churn_op=%s)", ops[0])
+		} else {
+			c.title = "Fraction of keys moved vs algorithm"
+		}
+		rep.summary = append(rep.summary, namedChart{"summary_moved_ratio_vs_algo.svg", c})
+	}
+	return rep
+}
+
+// perNodeChart charts a file's per-node rows: keys before and after for
+// churn runs, the moved ratio per node for churn-each, or the key count.
+func perNodeChart(r *result) (namedChart, bool) {
+	nodeCol := r.column("node_id")
+	if nodeCol < 0 || len(r.rows) == 0 {
+		return namedChart{}, false
+	}
+	var labels []string
+	for _, row := range r.rows {
+		labels = append(labels, cell(row, nodeCol))
+	}
+	algo, nodes, zipf := r.lookup["algo"], r.lookup["nodes"], r.lookup["zipf_s"]
+	if nodes == "" {
+		nodes = r.lookup["nodes_before"] // churn-each
+	}
+
+	if before, after := r.column("count_before"), r.column("count_after"); before >= 0 && after >= 0 {
+		op := r.lookup["churn_op"]
+		nb, na := r.lookup["nodes_before"], r.lookup["nodes_after"]
+		return namedChart{
+			file: fmt.Sprintf("churn_per_node_%s_%s_nb%s_na%s_zipf%s.svg", algo, op, nb, na, zipf),
+			chart: barChart{
+				title:  fmt.Sprintf("Churn per-node load (%s)\nalgo=%s, nodes %s→%s, %s", op, algo, nb, na, workloadLabel(r)),
+				yLabel: "Count",
+				labels: labels,
+				series: []series{
+					{"before", columnValues(r, before)},
+					{"after", columnValues(r, after)},
+				},
+			},
+		}, true
+	}
+	if col := r.column("moved_ratio"); col >= 0 && r.mode() == "churn-each" {
+		op := r.lookup["churn_op"]
+		return namedChart{
+			file: fmt.Sprintf("churn_each_%s_%s_nodes%s_zipf%s.svg", algo, op, nodes, zipf),
+			chart: barChart{
+				title:  fmt.Sprintf("Moved ratio per churned node (%s)\nalgo=%s, nodes=%s, %s", op, algo, nodes, workloadLabel(r)),
+				yLabel: "moved_ratio",
+				labels: labels,
+				series: []series{{"moved_ratio", columnValues(r, col)}},
+			},
+		}, true
+	}
+	if col := r.column("count"); col >= 0 {
+		return namedChart{
+			file: fmt.Sprintf("per_node_%s_nodes%s_zipf%s.svg", algo, nodes, zipf),
+			chart: barChart{
+				title:  fmt.Sprintf("Per-node load distribution\nalgo=%s, nodes=%s, keys=%s, %s", algo, nodes, r.lookup["keys"], workloadLabel(r)),
+				yLabel: "Count",
+				labels: labels,
+				series: []series{{"count", columnValues(r, col)}},
+			},
+		}, true
+	}
+	return namedChart{}, false
+}
+
+// compareChart charts one value per result, labelled by algorithm and
+// sorted by label. Results without the value are left out.
+func compareChart(results []*result, key string, value func(*result) (float64, bool)) (barChart, bool) {
+	type point struct {
+		label string
+		y     float64
+	}
+	var pts []point
+	algos := make(map[string]int)
+	for _, r := range results {
+		algos[r.lookup["algo"]]++
+	}
+	for _, r := range results {
+		y, ok := value(r)
+		if !ok {
+			continue
+		}
+		label := r.lookup["algo"]
+		if algos[label] > 1 {
+			// several runs of one algorithm: tell them apart by file
+			label = r.name
+		}
+		pts = append(pts, point{label, y})
+	}
+	if len(pts) == 0 {
+		return barChart{}, false
+	}
+	sort.SliceStable(pts, func(i, j int) bool { return pts[i].label < pts[j].label })
+	c := barChart{title: key + " vs algorithm", yLabel: key}
+	s := series{name: key}
+	for _, p := range pts {
+		c.labels = append(c.labels, p.label)
+		s.values = append(s.values, p.y)
+	}
+	c.series = []series{s}
+	return c, true
+}
+
+// distStat reads a dist summary metric. max_avg falls back to max/mean
+// for files written before the fairness rows.
+func distStat(key string) func(*result) (float64, bool) {
+	if key != "max_avg" {
+		return metaFloat(key)
+	}
+	return func(r *result) (float64, bool) {
+		if v, ok := metaFloat("max_avg")(r); ok {
+			return v, true
+		}
+		mx, ok1 := metaFloat("max")(r)
+		mean, ok2 := metaFloat("mean")(r)
+		if !ok1 || !ok2 || mean == 0 {
+			return 0, false
+		}
+		return mx / mean, true
+	}
+}
+
+func metaFloat(key string) func(*result) (float64, bool) {
+	return func(r *result) (float64, bool) {
+		s, ok := r.get(key)
+		if !ok {
+			return 0, false
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		return v, err == nil
+	}
+}
+
+// workloadLabel describes the workload of a run for chart titles.
+func workloadLabel(r *result) string {
+	switch {
+	case r.lookup["trace"] != "":
+		return "trace=" + filepath.Base(r.lookup["trace"])
+	case r.lookup["workload"] != "":
+		return "workload=" + r.lookup["workload"]
+	default:
+		return "zipf_s=" + r.lookup["zipf_s"]
+	}
+}
+
+func distinct(results []*result, key string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, r := range results {
+		if v := r.lookup[key]; !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func columnValues(r *result, col int) []float64 {
+	out := make([]float64, len(r.rows))
+	for i, row := range r.rows {
+		v, err := strconv.ParseFloat(strings.TrimSpace(cell(row, col)), 64)
+		if err != nil {
+			v = 0
+		}
+		out[i] = v
+	}
+	return out
+}
+
+func cell(row []string, col int) string {
+	if col < len(row) {
+		return row[col]
+	}
+	return ""
+}
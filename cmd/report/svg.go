@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// series is one set of bars, one value per chart label.
+type series struct {
+	name   string
+	values []float64
+}
+
+// barChart is a vertical bar chart with one group of bars per label.
+type barChart struct {
+	title  string
+	yLabel string
+	labels []string
+	series []series
+}
+
+// colours cycle over the series, as matplotlib's default palette does.
+var colours = []string{"#4682b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b"}
+
+// Chart geometry in SVG user units.
+const (
+	chartWidth   = 960
+	chartHeight  = 480
+	marginLeft   = 80
+	marginRight  = 20
+	marginTop    = 60
+	marginBottom = 110
+	yTicks       = 5
+)
+
+// svg renders the chart as a standalone SVG document.
+func (c barChart) svg() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="white"/>`+"\n", chartWidth, chartHeight)
+	for i, line := range strings.Split(c.title, "\n") {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" font-size="%d">%s</text>`+"\n",
+			chartWidth/2, 22+18*i, 16-2*min(i, 1), esc(line))
+	}
+
+	plotW := float64(chartWidth - marginLeft - marginRight)
+	plotH := float64(chartHeight - marginTop - marginBottom)
+	x0, y0 := float64(marginLeft), float64(marginTop)+plotH
+
+	lo, hi := c.valueRange()
+	step := niceStep((hi - lo) / yTicks)
+	lo = math.Floor(lo/step) * step
+	hi = math.Ceil(hi/step) * step
+	if hi == lo {
+		hi = lo + step
+	}
+	y := func(v float64) float64 { return y0 - (v-lo)/(hi-lo)*plotH }
+
+	// grid and y axis labels
+	for v := lo; v <= hi+step/2; v += step {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n", x0, y(v), x0+plotW, y(v))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="end">%s</text>`+"\n", x0-6, y(v)+4, formatTick(v, step))
+	}
+	fmt.Fprintf(&b, `<text transform="translate(18,%.1f) rotate(-90)" text-anchor="middle">%s</text>`+"\n", y0-plotH/2, esc(c.yLabel))
+
+	// bars
+	n := len(c.labels)
+	if n > 0 && len(c.series) > 0 {
+		slot := plotW / float64(n)
+		barW := slot * 0.8 / float64(len(c.series))
+		for si, s := range c.series {
+			colour := colours[si%len(colours)]
+			for i, v := range s.values {
+				if i >= n || math.IsNaN(v) {
+					continue
+				}
+				// valueRange includes 0, so bars grow from the zero line
+				top, bottom := y(v), y(0)
+				if top > bottom {
+					top, bottom = bottom, top
+				}
+				x := x0 + slot*float64(i) + slot*0.1 + barW*float64(si)
+				fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`+"\n",
+					x, top, barW, bottom-top, colour, esc(c.labels[i]), strconv.FormatFloat(v, 'g', 6, 64))
+			}
+		}
+		for i, l := range c.labels {
+			cx := x0 + slot*(float64(i)+0.5)
+			fmt.Fprintf(&b, `<text transform="translate(%.1f,%.1f) rotate(-40)" text-anchor="end">%s</text>`+"\n", cx, y0+14, esc(l))
+		}
+	}
+	fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/>`+"\n", x0, y0, x0+plotW, y0)
+	fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/>`+"\n", x0, y0, x0, y0-plotH)
+
+	// legend for grouped bars
+	if len(c.series) > 1 {
+		for si, s := range c.series {
+			lx, ly := x0+plotW-120, float64(marginTop)+8+18*float64(si)
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="12" height="12" fill="%s"/>`+"\n", lx, ly, colours[si%len(colours)])
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f">%s</text>`+"\n", lx+18, ly+10, esc(s.name))
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// valueRange returns the smallest and largest value, always including 0
+// so bars start at the axis.
+func (c barChart) valueRange() (lo, hi float64) {
+	for _, s := range c.series {
+		for _, v := range s.values {
+			if !math.IsNaN(v) {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+	return lo, hi
+}
+
+// niceStep rounds a raw tick spacing up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	if raw <= 0 || math.IsNaN(raw) || math.IsInf(raw, 0) {
+		return 1
+	}
+	p := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*p {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+// formatTick prints v with as many decimals as the tick step needs.
+func formatTick(v, step float64) string {
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+	}
+	if math.Abs(v) < step/1e6 {
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+func esc(s string) string { return html.EscapeString(s) }
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/metrics"
+	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/workload"
+)
+
+// ------------------ Compare-baseline mode ------------------
+
+// baselineParams configures -mode compare-baseline. Tolerances are
+// relative: a metric regresses when it exceeds its baseline value by more
+// than that fraction.
+type baselineParams struct {
+	glob     string
+	tolCV    float64
+	tolMax   float64
+	tolMoved float64
+}
+
+// printSlack absorbs the rounding of metrics printed with five or six
+// decimals in the baseline files.
+const printSlack = 1e-5
+
+// baselineCheck compares one metric of one baseline file.
+type baselineCheck struct {
+	file, mode, algo string
+	metric           string
+	baseline         float64
+	current          float64
+	tolerance        float64
+	status           string // ok | improved | regressed
+}
+
+// metrics lists the metrics checked per mode and the tolerance
+// that applies to each.
+func (p baselineParams) metrics(mode string) []struct {
+	name string
+	tol  float64
+} {
+	type m = struct {
+		name string
+		tol  float64
+	}
+	switch mode {
+	case "dist":
+		return []m{{"cv", p.tolCV}, {"max", p.tolMax}}
+	case "churn":
+		return []m{{"moved_ratio", p.tolMoved}, {"cv_after", p.tolCV}, {"max_after", p.tolMax}}
+	case "churn-each":
+		return []m{{"moved_ratio_mean", p.tolMoved}, {"moved_ratio_max", p.tolMoved}}
+	}
+	return nil
+}
+
+// runCompareBaseline reruns the dist, churn and churn-each runs recorded in
+// the files matching p.glob with the configuration in their summary rows,
+// and writes one row per checked metric. It returns the number of
+// regressions.
+func runCompareBaseline(p baselineParams, dest output) (int, error) {
+	paths, err := filepath.Glob(p.glob)
+	if err != nil {
+		return 0, fmt.Errorf("baseline glob: %w", err)
+	}
+	if len(paths) == 0 {
+		return 0, fmt.Errorf("no baseline files match %q", p.glob)
+	}
+	sort.Strings(paths)
+
+	var checks []baselineCheck
+	var skipped []string
+	for _, path := range paths {
+		meta, err := readBaselineMeta(path)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		mode := meta["mode"]
+		if p.metrics(mode) == nil {
+			skipped = append(skipped, path)
+			log.Printf("compare-baseline: skip %s (mode %q cannot be rerun)", path, mode)
+			continue
+		}
+		current, err := rerunBaseline(meta)
+		if err != nil {
+			return 0, fmt.Errorf("%s: rerun: %w", path, err)
+		}
+		for _, m := range p.metrics(mode) {
+			raw, ok := meta[m.name]
+			if !ok {
+				continue // older files lack some rows
+			}
+			base, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%s: #%s: %w", path, m.name, err)
+			}
+			c := baselineCheck{
+				file: path, mode: mode, algo: meta["algo"], metric: m.name,
+				baseline: base, current: current[m.name], tolerance: m.tol, status: "ok",
+			}
+			switch {
+			case c.current > base*(1+m.tol)+printSlack:
+				c.status = "regressed"
+			case c.current < base*(1-m.tol)-printSlack:
+				c.status = "improved"
+			}
+			checks = append(checks, c)
+		}
+	}
+
+	regressions := 0
+	for _, c := range checks {
+		if c.status == "regressed" {
+			regressions++
+		}
+	}
+	if err := writeBaselineChecks(checks, len(paths), len(skipped), regressions, p, dest); err != nil {
+		return 0, err
+	}
+	if regressions > 0 {
+		printBaselineDiff(os.Stderr, checks)
+	}
+	log.Printf("mode=compare-baseline files=%d skipped=%d checks=%d regressions=%d",
+		len(paths), len(skipped), len(checks), regressions)
+	return regressions, nil
+}
+
+// readBaselineMeta returns the "#key,value" rows of a CSV result file.
+func readBaselineMeta(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	meta := make(map[string]string)
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return meta, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) >= 2 && strings.HasPrefix(rec[0], "#") {
+			meta[strings.TrimPrefix(rec[0], "#")] = rec[1]
+		}
+	}
+}
+
+// rerunBaseline repeats the run described by a baseline file's summary
+// rows and returns the metrics it would write.
+func rerunBaseline(meta map[string]string) (map[string]float64, error) {
+	var errs []error
+	num := func(key string, def float64) float64 {
+		s, ok := meta[key]
+		if !ok {
+			return def
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("#%s: %w", key, err))
+		}
+		return v
+	}
+
+	algoEnum, err := parseAlgo(meta["algo"])
+	if err != nil {
+		return nil, err
+	}
+	nodesN := int(num("nodes", num("nodes_before", 0)))
+	seed := int64(num("seed", 0))
+	zones := int(num("zones", 0))
+	spread, err := parseDomain(meta["spread"])
+	if err != nil {
+		return nil, err
+	}
+	if zones == 0 {
+		spread = rc.DomainNone
+	}
+	opts := rc.Options{
+		TableSize:     int(num("table_size", 65537)),
+		LoadFactor:    num("load_factor", 1.25),
+		Vnodes:        int(num("vnodes", 100)),
+		WalkThreshold: int(num("walk_threshold", 8)),
+		HashSeed:      uint64(seed),
+		HashFunc:      meta["hash"],
+		Topology:      buildTopology(nodesN+1, zones),
+		ReplicaSpread: spread,
+	}
+	wl, err := baselineWorkload(meta, int(num("keys", 0)), num("zipf_s", 0))
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if nodesN <= 0 {
+		return nil, errors.New("no #nodes row")
+	}
+
+	nodes := make([]string, nodesN)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("node-%d", i)
+	}
+	wl.algo, wl.nodes, wl.opts = algoEnum, nodes, opts
+	keys, weights, err := wl.requests(seed)
+	if err != nil {
+		return nil, err
+	}
+	opts = sizedFor(opts, keys, weights)
+
+	cp := churnParams{
+		op:       meta["churn_op"],
+		zones:    zones,
+		failZone: meta["fail_zone"],
+		replicas: int(num("replicas", 3)),
+	}
+	for _, key := range []string{"removed_nodes", "drain_node", "flap_node"} {
+		if v := meta[key]; v != "" {
+			cp.targets = strings.Split(v, ";")
+		}
+	}
+
+	switch meta["mode"] {
+	case "dist":
+		res, err := simulateDistribution(algoEnum, nodes, keys, weights, opts)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"cv": res.stats.CV, "max": float64(res.stats.Max)}, nil
+	case "churn":
+		res, err := simulateChurn(algoEnum, nodes, keys, weights, opts, cp)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{
+			"moved_ratio": res.movedRatio(),
+			"cv_after":    res.statsAfter.CV,
+			"max_after":   float64(res.statsAfter.Max),
+		}, nil
+	case "churn-each":
+		cp.targets = nil
+		results, err := simulateChurnEach(algoEnum, nodes, keys, weights, opts, cp)
+		if err != nil {
+			return nil, err
+		}
+		ratios := make([]float64, len(results))
+		worst := 0.0
+		for i, r := range results {
+			ratios[i] = r.movedRatio()
+			worst = math.Max(worst, ratios[i])
+		}
+		return map[string]float64{
+			"moved_ratio_mean": metrics.EstimateMean(ratios).Mean,
+			"moved_ratio_max":  worst,
+		}, nil
+	}
+	return nil, fmt.Errorf("mode %q cannot be rerun", meta["mode"])
+}
+
+// baselineWorkload rebuilds the workload from the #zipf_s, #workload or
+// #trace rows.
+func baselineWorkload(meta map[string]string, keys int, zipfS float64) (workloadSpec, error) {
+	wl := workloadSpec{keys: keys, zipfS: zipfS}
+	switch {
+	case meta["trace"] != "":
+		t, err := workload.LoadTrace(meta["trace"])
+		if err != nil {
+			return wl, fmt.Errorf("trace: %w", err)
+		}
+		wl.trace, wl.tracePath = t, meta["trace"]
+	case meta["workload"] != "":
+		name := meta["workload"]
+		var params []string
+		for _, p := range generatorParams[name] {
+			if v, ok := meta["workload_"+p.name]; ok {
+				params = append(params, p.name+"="+v)
+			}
+		}
+		gen, err := parseGenerator(name + ":" + strings.Join(params, ","))
+		if err != nil {
+			return wl, err
+		}
+		wl.gen = gen
+	}
+	return wl, nil
+}
+
+func writeBaselineChecks(checks []baselineCheck, files, skipped, regressions int, p baselineParams, dest output) (err error) {
+	out, w, err := createWriter(dest)
+	if err != nil {
+		return err
+	}
+	defer closeOutput(out, w, &err)
+
+	if err := w.Write([]string{
+		"file", "mode", "algo", "metric", "baseline", "current", "delta", "delta_ratio", "tolerance", "status",
+	}); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	for _, c := range checks {
+		if err := w.Write([]string{
+			c.file,
+			c.mode,
+			c.algo,
+			c.metric,
+			strconv.FormatFloat(c.baseline, 'f', -1, 64),
+			fmt.Sprintf("%.6f", c.current),
+			fmt.Sprintf("%.6f", c.current-c.baseline),
+			fmt.Sprintf("%.6f", deltaRatio(c)),
+			fmt.Sprintf("%.4f", c.tolerance),
+			c.status,
+		}); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+	}
+
+	summaryRows := [][]string{
+		{"#mode", "compare-baseline"},
+		{"#baseline", p.glob},
+		{"#tolerance_cv", fmt.Sprintf("%.4f", p.tolCV)},
+		{"#tolerance_max", fmt.Sprintf("%.4f", p.tolMax)},
+		{"#tolerance_moved", fmt.Sprintf("%.4f", p.tolMoved)},
+		{"#files", fmt.Sprintf("%d", files)},
+		{"#skipped", fmt.Sprintf("%d", skipped)},
+		{"#checks", fmt.Sprintf("%d", len(checks))},
+		{"#regressions", fmt.Sprintf("%d", regressions)},
+	}
+	for _, row := range summaryRows {
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("write summary row: %w", err)
+		}
+	}
+	return nil
+}
+
+// printBaselineDiff writes an aligned table of the regressed metrics.
+func printBaselineDiff(out io.Writer, checks []baselineCheck) {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tALGO\tMETRIC\tBASELINE\tCURRENT\tCHANGE\tTOLERANCE")
+	for _, c := range checks {
+		if c.status != "regressed" {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%g\t%.6g\t%+.2f%%\t%.2f%%\n",
+			c.file, c.algo, c.metric, c.baseline, c.current, 100*deltaRatio(c), 100*c.tolerance)
+	}
+	tw.Flush()
+}
+
+// deltaRatio is the change relative to the baseline value (0 if the
+// baseline is 0).
+func deltaRatio(c baselineCheck) float64 {
+	if c.baseline == 0 {
+		return 0
+	}
+	return (c.current - c.baseline) / c.baseline
+}
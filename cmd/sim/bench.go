@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	router "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router"
+	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+// ------------------ Bench mode ------------------
+
+// benchParams configures bench mode. The algorithm grid reuses the sweep
+// lists (algorithms, vnodes, load factors, table sizes, walk thresholds);
+// nodes and procs are the bench's own lists.
+type benchParams struct {
+	grid  sweepParams
+	procs []int         // GOMAXPROCS values for the parallel throughput runs
+	time  time.Duration // time spent on each measurement
+}
+
+// benchResult holds the measurements of one configuration.
+type benchResult struct {
+	buildMs    float64
+	addUs      float64
+	removeUs   float64
+	memBytes   uint64
+	pickNs     float64
+	pickAllocs float64
+	pickBytes  float64
+	opsPerSec  []float64 // one per benchParams.procs
+}
+
+// defaultBenchProcs returns 1, 2, 4, ... up to and including n.
+func defaultBenchProcs(n int) []int {
+	var out []int
+	for p := 1; p < n; p *= 2 {
+		out = append(out, p)
+	}
+	return append(out, n)
+}
+
+// benchPass is one timed run over the key pool; it returns the number of
+// operations done.
+type benchPass func() int
+
+// measure runs pass until at least d has been spent inside it, calling
+// reset (untimed) before every pass, and returns the time spent, the
+// operations done and the heap allocations and bytes they made.
+func measure(d time.Duration, pass benchPass, reset func()) (elapsed time.Duration, ops int, mallocs, bytes uint64) {
+	var before, after runtime.MemStats
+	for elapsed < d {
+		if reset != nil {
+			reset()
+		}
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		ops += pass()
+		elapsed += time.Since(start)
+		runtime.ReadMemStats(&after)
+		mallocs += after.Mallocs - before.Mallocs
+		bytes += after.TotalAlloc - before.TotalAlloc
+	}
+	return elapsed, ops, mallocs, bytes
+}
+
+// heapInUse returns the live heap after a full collection.
+func heapInUse() uint64 {
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+// runBenchConfig measures one configuration: the cost of building the
+// mapper and its retained heap, one Add and one Remove of an extra node,
+// single-goroutine Pick over the key pool and parallel Pick throughput for
+// every GOMAXPROCS value.
+//
+// CH-BL's Pick counts load, so its passes run with the bound sized to the
+// key pool and the loads are reset (untimed) before each pass; Pick cost
+// includes the walks past full nodes as the pass fills them.
+func runBenchConfig(c sweepConfig, bp benchParams, keys [][]byte) (benchResult, error) {
+	var res benchResult
+	algoEnum, err := parseAlgo(c.algo)
+	if err != nil {
+		return res, err
+	}
+	nodes := make([]string, c.nodes)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("node-%d", i)
+	}
+
+	// build time and retained heap
+	heapBefore := heapInUse()
+	start := time.Now()
+	m, err := router.New(algoEnum, c.opts, nodes)
+	if err != nil {
+		return res, err
+	}
+	buildT, builds := time.Since(start), 1
+	if h := heapInUse(); h > heapBefore {
+		res.memBytes = h - heapBefore
+	}
+	for buildT < bp.time {
+		start := time.Now()
+		if _, err := router.New(algoEnum, c.opts, nodes); err != nil {
+			return res, err
+		}
+		buildT += time.Since(start)
+		builds++
+	}
+	res.buildMs = float64(buildT) / float64(builds) / float64(time.Millisecond)
+
+	// Add and Remove of one extra node
+	const extra = "node-bench-extra"
+	var addT, removeT time.Duration
+	reps := 0
+	for addT+removeT < bp.time || reps == 0 {
+		start := time.Now()
+		m.Add(extra)
+		addT += time.Since(start)
+		start = time.Now()
+		m.Remove(extra)
+		removeT += time.Since(start)
+		reps++
+	}
+	res.addUs = float64(addT) / float64(reps) / float64(time.Microsecond)
+	res.removeUs = float64(removeT) / float64(reps) / float64(time.Microsecond)
+
+	var reset func()
+	if lr, ok := m.(rc.LoadResetter); ok {
+		reset = lr.ResetLoad
+	}
+
+	// single-goroutine Pick
+	elapsed, ops, mallocs, bytes := measure(bp.time, func() int {
+		for _, k := range keys {
+			m.Pick(k)
+		}
+		return len(keys)
+	}, reset)
+	res.pickNs = float64(elapsed.Nanoseconds()) / float64(ops)
+	res.pickAllocs = float64(mallocs) / float64(ops)
+	res.pickBytes = float64(bytes) / float64(ops)
+
+	// parallel throughput: p goroutines split each pass over the pool
+	for _, p := range bp.procs {
+		prev := runtime.GOMAXPROCS(p)
+		elapsed, ops, _, _ := measure(bp.time, func() int {
+			var wg sync.WaitGroup
+			for w := 0; w < p; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := w; i < len(keys); i += p {
+						m.Pick(keys[i])
+					}
+				}(w)
+			}
+			wg.Wait()
+			return len(keys)
+		}, reset)
+		runtime.GOMAXPROCS(prev)
+		res.opsPerSec = append(res.opsPerSec, float64(ops)/elapsed.Seconds())
+	}
+	return res, nil
+}
+
+// runBench measures every configuration of the grid in turn (never
+// concurrently, so measurements do not disturb each other) and writes one
+// row per configuration.
+func runBench(bp benchParams, base rc.Options, keys [][]byte, wl workloadSpec, seed int64, dest output) (err error) {
+	if len(keys) == 0 {
+		return fmt.Errorf("bench needs a non-empty key pool")
+	}
+	base.ExpectedKeys = len(keys)
+	base.ExpectedWeight = 0 // Pick counts unit loads
+	grid := bp.grid
+	grid.keys, grid.zipfS = []int{len(keys)}, []float64{0}
+	grid.replay = workloadSpec{}
+	configs, err := expandSweep(grid, base)
+	if err != nil {
+		return err
+	}
+
+	results := make([]benchResult, len(configs))
+	for i, c := range configs {
+		if results[i], err = runBenchConfig(c, bp, keys); err != nil {
+			return fmt.Errorf("bench config %d (%s nodes=%d): %w", i, c.algo, c.nodes, err)
+		}
+		r := results[i]
+		log.Printf("bench algo=%s nodes=%d build_ms=%.3f add_us=%.1f remove_us=%.1f mem_bytes=%d pick_ns=%.1f",
+			c.algo, c.nodes, r.buildMs, r.addUs, r.removeUs, r.memBytes, r.pickNs)
+	}
+
+	out, w, err := createWriter(dest)
+	if err != nil {
+		return err
+	}
+	defer closeOutput(out, w, &err)
+
+	header := []string{
+		"algo", "nodes", "vnodes", "load_factor", "table_size", "walk_threshold", "hash",
+		"build_ms", "add_us", "remove_us", "mem_bytes", "mem_bytes_per_node",
+		"pick_ns", "pick_allocs", "pick_bytes",
+	}
+	for _, p := range bp.procs {
+		header = append(header, fmt.Sprintf("ops_per_sec_p%d", p))
+	}
+	if err := w.Write(header); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	for i, c := range configs {
+		r := results[i]
+		row := []string{
+			c.algo,
+			strconv.Itoa(c.nodes),
+			usedInt(c.usesVnodes, c.opts.Vnodes),
+			usedFloat(c.usesLoadFactor, c.opts.LoadFactor),
+			usedInt(c.usesTableSize, c.opts.TableSize),
+			usedInt(c.usesWalkThreshold, c.opts.WalkThreshold),
+			hashFuncName(c.opts),
+			fmt.Sprintf("%.3f", r.buildMs),
+			fmt.Sprintf("%.1f", r.addUs),
+			fmt.Sprintf("%.1f", r.removeUs),
+			strconv.FormatUint(r.memBytes, 10),
+			fmt.Sprintf("%.1f", float64(r.memBytes)/float64(c.nodes)),
+			fmt.Sprintf("%.1f", r.pickNs),
+			fmt.Sprintf("%.2f", r.pickAllocs),
+			fmt.Sprintf("%.1f", r.pickBytes),
+		}
+		for _, ops := range r.opsPerSec {
+			row = append(row, fmt.Sprintf("%.0f", ops))
+		}
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+	}
+
+	summaryRows := [][]string{
+		{"#mode", "bench"},
+		{"#keys", fmt.Sprintf("%d", len(keys))},
+		{"#seed", fmt.Sprintf("%d", seed)},
+		{"#bench_time", bp.time.String()},
+		{"#num_cpu", fmt.Sprintf("%d", runtime.NumCPU())},
+		{"#go_version", runtime.Version()},
+		{"#goos", runtime.GOOS},
+		{"#goarch", runtime.GOARCH},
+	}
+	summaryRows = append(summaryRows, wl.rows()...)
+	summaryRows = append(summaryRows, []string{"#configs", fmt.Sprintf("%d", len(configs))})
+	for _, row := range summaryRows {
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("write summary row: %w", err)
+		}
+	}
+
+	log.Printf("mode=bench configs=%d keys=%d procs=%v bench_time=%s", len(configs), len(keys), bp.procs, bp.time)
+	return nil
+}
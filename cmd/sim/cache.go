@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/cache"
+	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+// ------------------ Cache mode ------------------
+
+// cacheParams configures -mode cache.
+type cacheParams struct {
+	size   int // keys cached per node
+	window int // requests measured just before and just after each event
+}
+
+// cacheStep is the outcome of one segment of the request stream.
+type cacheStep struct {
+	name, op string
+	members  int
+	requests int
+	hits     int
+	unrouted int
+
+	// miss rate over the last window of the previous step and the first
+	// window of this one; the difference is the miss spike of the event
+	missBefore, missAfter float64
+}
+
+func (s cacheStep) hitRate() float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	return float64(s.hits) / float64(s.requests)
+}
+
+func (s cacheStep) missSpike() float64 { return s.missAfter - s.missBefore }
+
+// missRate is the fraction of false entries in hits.
+func missRate(hits []bool) float64 {
+	if len(hits) == 0 {
+		return 0
+	}
+	misses := 0
+	for _, h := range hits {
+		if !h {
+			misses++
+		}
+	}
+	return float64(misses) / float64(len(hits))
+}
+
+// runCache puts an LRU cache on every node and replays the request stream
+// across the steps of sc: the stream is cut into one equal segment per step,
+// and each step's membership change applies before its segment. Caches
+// survive while their node stays a member; a removed node comes back cold.
+func runCache(
+	algoName string,
+	algoEnum rc.Algo,
+	sc *scenario,
+	opts rc.Options,
+	wl workloadSpec,
+	cp cacheParams,
+	seed int64,
+	dest output,
+) (err error) {
+	state, err := sc.initialState()
+	if err != nil {
+		return err
+	}
+	keys, weights, err := wl.requests(seed)
+	if err != nil {
+		return err
+	}
+	if len(keys) < len(sc.Steps)*cp.window {
+		return fmt.Errorf("%d requests over %d steps leave fewer than -cache-window (%d) per step",
+			len(keys), len(sc.Steps), cp.window)
+	}
+
+	caches := make(map[string]*cache.LRU)
+	var nodeOrder []string // every node that was a member, in join order
+	nodeRequests := make(map[string]int)
+	nodeHits := make(map[string]int)
+
+	steps := make([]cacheStep, len(sc.Steps))
+	var prevTail float64
+	for i, st := range sc.Steps {
+		if err := state.apply(st); err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+		for id := range caches {
+			if !state.isMember(id) {
+				delete(caches, id)
+			}
+		}
+		for _, id := range state.members {
+			if _, seen := nodeRequests[id]; !seen {
+				nodeOrder = append(nodeOrder, id)
+				nodeRequests[id] = 0
+			}
+		}
+
+		lo, hi := i*len(keys)/len(sc.Steps), (i+1)*len(keys)/len(sc.Steps)
+		seg := keys[lo:hi]
+		var segWeights []float64
+		if weights != nil {
+			segWeights = weights[lo:hi]
+		}
+		m, err := state.mapper(algoEnum, sizedFor(opts, seg, segWeights))
+		if err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+		table := m.Nodes()
+
+		s := cacheStep{name: st.Name, op: st.Op, members: len(state.members), requests: len(seg)}
+		hits := make([]bool, len(seg))
+		for j, k := range seg {
+			idx := pickIndex(m, seg, segWeights, j)
+			if idx < 0 {
+				s.unrouted++
+				continue
+			}
+			id := table[idx]
+			c := caches[id]
+			if c == nil {
+				c = cache.NewLRU(cp.size)
+				caches[id] = c
+			}
+			nodeRequests[id]++
+			if hits[j] = c.Access(k); hits[j] {
+				s.hits++
+				nodeHits[id]++
+			}
+		}
+		s.missAfter = missRate(hits[:cp.window])
+		s.missBefore = prevTail
+		if i == 0 {
+			// cold caches: no steady state to compare against
+			s.missBefore = s.missAfter
+		}
+		prevTail = missRate(hits[len(hits)-cp.window:])
+		steps[i] = s
+	}
+
+	out, w, err := createWriter(dest)
+	if err != nil {
+		return err
+	}
+	defer closeOutput(out, w, &err)
+
+	if err := w.Write([]string{
+		"step", "name", "op", "members", "requests", "hits", "hit_rate",
+		"miss_before", "miss_after", "miss_spike", "unrouted",
+	}); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	var requests, hits, warmRequests, warmHits int
+	var spikeSum, spikeMax float64
+	for i, s := range steps {
+		if err := w.Write([]string{
+			strconv.Itoa(i),
+			s.name,
+			s.op,
+			strconv.Itoa(s.members),
+			strconv.Itoa(s.requests),
+			strconv.Itoa(s.hits),
+			fmt.Sprintf("%.6f", s.hitRate()),
+			fmt.Sprintf("%.6f", s.missBefore),
+			fmt.Sprintf("%.6f", s.missAfter),
+			fmt.Sprintf("%.6f", s.missSpike()),
+			strconv.Itoa(s.unrouted),
+		}); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+		requests += s.requests
+		hits += s.hits
+		if i > 0 {
+			warmRequests += s.requests
+			warmHits += s.hits
+			spikeSum += s.missSpike()
+			if i == 1 || s.missSpike() > spikeMax {
+				spikeMax = s.missSpike()
+			}
+		}
+	}
+
+	ratio := func(a, b int) float64 {
+		if b == 0 {
+			return 0
+		}
+		return float64(a) / float64(b)
+	}
+	spikeMean := 0.0
+	if len(steps) > 1 {
+		spikeMean = spikeSum / float64(len(steps)-1)
+	}
+	summaryRows := [][]string{
+		{"#mode", "cache"},
+		{"#algo", algoName},
+		{"#nodes", fmt.Sprintf("%d", sc.Cluster.Count)},
+		{"#keys", fmt.Sprintf("%d", len(keys))},
+	}
+	summaryRows = append(summaryRows, wl.rows()...)
+	summaryRows = append(summaryRows, [][]string{
+		{"#timeline", sc.Name},
+		{"#cache_size", fmt.Sprintf("%d", cp.size)},
+		{"#cache_window", fmt.Sprintf("%d", cp.window)},
+		{"#table_size", fmt.Sprintf("%d", opts.TableSize)},
+		{"#load_factor", fmt.Sprintf("%.3f", opts.LoadFactor)},
+		{"#vnodes", fmt.Sprintf("%d", opts.Vnodes)},
+		{"#walk_threshold", fmt.Sprintf("%d", opts.WalkThreshold)},
+		{"#seed", fmt.Sprintf("%d", seed)},
+		{"#hash", hashFuncName(opts)},
+		{"#steps", fmt.Sprintf("%d", len(steps))},
+		{"#hit_rate", fmt.Sprintf("%.6f", ratio(hits, requests))},
+		{"#hit_rate_after_baseline", fmt.Sprintf("%.6f", ratio(warmHits, warmRequests))},
+		{"#miss_spike_mean", fmt.Sprintf("%.6f", spikeMean)},
+		{"#miss_spike_max", fmt.Sprintf("%.6f", spikeMax)},
+	}...)
+	for _, id := range nodeOrder {
+		summaryRows = append(summaryRows, []string{
+			"#node_hit_rate_" + id, fmt.Sprintf("%.6f", ratio(nodeHits[id], nodeRequests[id])),
+		})
+	}
+	for _, row := range summaryRows {
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("write summary row: %w", err)
+		}
+	}
+
+	log.Printf("mode=cache algo=%s timeline=%s nodes=%d keys=%d %s cache_size=%d hit_rate=%.4f miss_spike_mean=%.4f miss_spike_max=%.4f",
+		algoName, sc.Name, sc.Cluster.Count, len(keys), wl, cp.size, ratio(hits, requests), spikeMean, spikeMax)
+	return nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/metrics"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/queueing"
+	router "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router"
+	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+// ------------------ Latency mode ------------------
+
+// latencyParams configures -mode latency.
+type latencyParams struct {
+	serviceRate float64 // requests per second one server completes
+	concurrency int     // servers (parallel requests) per node
+	service     string  // service time distribution: exp | const
+	arrivalRate float64 // Poisson arrivals per second over the cluster (0 = from utilization)
+	utilization float64 // offered load per server when arrivalRate is 0
+	timeUnit    float64 // seconds per trace timestamp unit
+}
+
+// rate returns the Poisson arrival rate in requests per second.
+func (p latencyParams) rate(nodes int) float64 {
+	if p.arrivalRate > 0 {
+		return p.arrivalRate
+	}
+	return p.utilization * p.serviceRate * float64(nodes*p.concurrency)
+}
+
+// latencyResult is the outcome of one latency simulation. Latencies are
+// recorded in microseconds.
+type latencyResult struct {
+	perNode     []int // requests per node, in nodes order
+	stats       metrics.IntStats
+	latency     []*metrics.Accumulator // per node
+	queue       []*metrics.Accumulator // requests waiting, seen on arrival
+	utilization []float64
+	all         metrics.Accumulator
+	maxQueue    int64
+	unrouted    int  // requests the mapper could not place; not in the latencies
+	replayed    bool // arrivals taken from trace timestamps
+}
+
+// ms converts a microsecond statistic to milliseconds.
+func ms(us float64) float64 { return us / 1000 }
+
+// simulateLatency routes the requests through a fresh mapper over nodes, in
+// arrival order, and queues each one at its node. Arrivals are Poisson, or
+// the trace's timestamps if it has them; service times are drawn from rng
+// seeded with seed and scaled by each request's weight relative to the mean.
+//
+// CH-BL bounds the requests in flight (Options.BoundInFlight): each request
+// counts against its node from arrival until it completes, when it is
+// released, so the bound tracks queue lengths rather than request totals.
+func simulateLatency(
+	algoEnum rc.Algo,
+	nodes []string,
+	keys [][]byte,
+	weights []float64,
+	times []float64,
+	opts rc.Options,
+	lp latencyParams,
+	seed int64,
+) (latencyResult, error) {
+	opts.BoundInFlight = true
+	mapper, err := router.New(algoEnum, opts, nodes)
+	if err != nil {
+		return latencyResult{}, fmt.Errorf("construct mapper: %w", err)
+	}
+	releaser, _ := mapper.(rc.LoadReleaser)
+	var inFlight completionHeap
+	table := mapper.Nodes()
+	positions := tablePositions(table, nodes)
+
+	res := latencyResult{
+		perNode:     make([]int, len(nodes)),
+		latency:     make([]*metrics.Accumulator, len(nodes)),
+		queue:       make([]*metrics.Accumulator, len(nodes)),
+		utilization: make([]float64, len(nodes)),
+		replayed:    times != nil,
+	}
+	stations := make([]*queueing.Station, len(nodes))
+	for i := range nodes {
+		stations[i] = queueing.NewStation(lp.concurrency)
+		res.latency[i] = &metrics.Accumulator{}
+		res.queue[i] = &metrics.Accumulator{}
+	}
+
+	// requests in arrival order; trace timestamps need not be sorted
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	if times != nil {
+		sort.SliceStable(order, func(a, b int) bool { return times[order[a]] < times[order[b]] })
+	}
+
+	meanWeight := 1.0
+	if weights != nil {
+		var sum float64
+		for _, w := range weights {
+			sum += w
+		}
+		if sum > 0 {
+			meanWeight = sum / float64(len(weights))
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	rate := lp.rate(len(nodes))
+	var now float64
+	for n, i := range order {
+		if times != nil {
+			now = (times[i] - times[order[0]]) * lp.timeUnit
+		} else if n > 0 {
+			now += rng.ExpFloat64() / rate
+		}
+		service := 1 / lp.serviceRate
+		if lp.service == "exp" {
+			service *= rng.ExpFloat64()
+		}
+		if weights != nil {
+			service *= weights[i] / meanWeight
+		}
+
+		if releaser != nil {
+			for len(inFlight) > 0 && inFlight[0].at <= now {
+				c := heap.Pop(&inFlight).(completion)
+				releaser.ReleaseIndex(c.idx, c.weight)
+			}
+		}
+
+		idx := pickIndex(mapper, keys, weights, i)
+		pos := listPosition(positions, idx)
+		if pos < 0 {
+			res.unrouted++
+			continue
+		}
+		done, queued := stations[pos].Offer(now, service)
+		if releaser != nil {
+			c := completion{at: done, idx: idx, weight: 1}
+			if weights != nil {
+				c.weight = weights[i]
+			}
+			heap.Push(&inFlight, c)
+		}
+		us := int64(math.Round((done - now) * 1e6))
+		res.perNode[pos]++
+		res.latency[pos].Add(us)
+		res.queue[pos].Add(int64(queued))
+		res.all.Add(us)
+	}
+
+	// utilization over the whole run, from time 0 to the last completion
+	var span float64
+	for _, st := range stations {
+		span = max(span, st.Done())
+	}
+	for i, st := range stations {
+		res.utilization[i] = st.Utilization(span)
+		res.maxQueue = max(res.maxQueue, res.queue[i].Max())
+	}
+	res.stats = metrics.ComputeIntStats(res.perNode)
+	return res, nil
+}
+
+// completion is a routed request that is still in flight: it completes at
+// time at and then releases weight from node index idx.
+type completion struct {
+	at     float64
+	idx    int
+	weight float64
+}
+
+// completionHeap is a min-heap of completions by time.
+type completionHeap []completion
+
+func (h completionHeap) Len() int           { return len(h) }
+func (h completionHeap) Less(i, j int) bool { return h[i].at < h[j].at }
+func (h completionHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *completionHeap) Push(x any)        { *h = append(*h, x.(completion)) }
+func (h *completionHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// latencyTimes returns the trace timestamps to replay, or nil for Poisson
+// arrivals.
+func latencyTimes(wl workloadSpec, keys [][]byte) []float64 {
+	if wl.trace == nil || wl.trace.Times == nil {
+		return nil
+	}
+	return wl.trace.Times[:len(keys)]
+}
+
+func runLatency(
+	algoName string,
+	algoEnum rc.Algo,
+	nodes []string,
+	keys [][]byte,
+	weights []float64,
+	opts rc.Options,
+	wl workloadSpec,
+	lp latencyParams,
+	seed int64,
+	trials int,
+	dest output,
+) (err error) {
+	res, err := simulateLatency(algoEnum, nodes, keys, weights, latencyTimes(wl, keys), opts, lp, seed)
+	if err != nil {
+		return err
+	}
+
+	var trialRows [][]string
+	var tr trialSummary
+	if trials > 1 {
+		if tr, err = latencyTrials(algoEnum, nodes, opts, wl, lp, seed, trials, res); err != nil {
+			return err
+		}
+		trialRows = tr.rows()
+	}
+
+	out, w, err := createWriter(dest)
+	if err != nil {
+		return err
+	}
+	defer closeOutput(out, w, &err)
+
+	if err := w.Write([]string{
+		"node_id", "count", "utilization",
+		"mean_ms", "p50_ms", "p99_ms", "p999_ms", "max_ms",
+		"mean_queue", "max_queue",
+	}); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	for i, id := range nodes {
+		l, q := res.latency[i], res.queue[i]
+		if err := w.Write([]string{
+			id,
+			fmt.Sprintf("%d", res.perNode[i]),
+			fmt.Sprintf("%.4f", res.utilization[i]),
+			fmt.Sprintf("%.3f", ms(l.Mean())),
+			fmt.Sprintf("%.3f", ms(l.Quantile(0.5))),
+			fmt.Sprintf("%.3f", ms(l.Quantile(0.99))),
+			fmt.Sprintf("%.3f", ms(l.Quantile(0.999))),
+			fmt.Sprintf("%.3f", ms(float64(l.Max()))),
+			fmt.Sprintf("%.3f", q.Mean()),
+			fmt.Sprintf("%d", q.Max()),
+		}); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+	}
+
+	maxUtil := 0.0
+	for _, u := range res.utilization {
+		maxUtil = max(maxUtil, u)
+	}
+	summaryRows := [][]string{
+		{"#mode", "latency"},
+		{"#algo", algoName},
+		{"#nodes", fmt.Sprintf("%d", len(nodes))},
+		{"#keys", fmt.Sprintf("%d", len(keys))},
+	}
+	summaryRows = append(summaryRows, wl.rows()...)
+	if res.replayed {
+		summaryRows = append(summaryRows, [][]string{
+			{"#arrivals", "trace"},
+			{"#trace_time_unit", fmt.Sprintf("%g", lp.timeUnit)},
+		}...)
+	} else {
+		summaryRows = append(summaryRows, [][]string{
+			{"#arrivals", "poisson"},
+			{"#arrival_rate", fmt.Sprintf("%.3f", lp.rate(len(nodes)))},
+		}...)
+	}
+	summaryRows = append(summaryRows, [][]string{
+		{"#service_rate", fmt.Sprintf("%.3f", lp.serviceRate)},
+		{"#concurrency", fmt.Sprintf("%d", lp.concurrency)},
+		{"#service", lp.service},
+		{"#table_size", fmt.Sprintf("%d", opts.TableSize)},
+		{"#load_factor", fmt.Sprintf("%.3f", opts.LoadFactor)},
+		{"#vnodes", fmt.Sprintf("%d", opts.Vnodes)},
+		{"#walk_threshold", fmt.Sprintf("%d", opts.WalkThreshold)},
+		{"#seed", fmt.Sprintf("%d", seed)},
+		{"#hash", hashFuncName(opts)},
+		{"#cv", fmt.Sprintf("%.5f", res.stats.CV)},
+		{"#max_avg", fmt.Sprintf("%.5f", res.stats.MaxAvg)},
+		{"#max_utilization", fmt.Sprintf("%.4f", maxUtil)},
+		{"#mean_ms", fmt.Sprintf("%.3f", ms(res.all.Mean()))},
+		{"#p50_ms", fmt.Sprintf("%.3f", ms(res.all.Quantile(0.5)))},
+		{"#p99_ms", fmt.Sprintf("%.3f", ms(res.all.Quantile(0.99)))},
+		{"#p999_ms", fmt.Sprintf("%.3f", ms(res.all.Quantile(0.999)))},
+		{"#max_ms", fmt.Sprintf("%.3f", ms(float64(res.all.Max())))},
+		{"#max_queue", fmt.Sprintf("%d", res.maxQueue)},
+		{"#unrouted", fmt.Sprintf("%d", res.unrouted)},
+	}...)
+	summaryRows = append(summaryRows, trialRows...)
+
+	for _, row := range summaryRows {
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("write summary row: %w", err)
+		}
+	}
+
+	log.Printf("mode=latency algo=%s nodes=%d keys=%d %s max_util=%.3f p50=%.3fms p99=%.3fms p999=%.3fms max_queue=%d unrouted=%d",
+		algoName, len(nodes), len(keys), wl, maxUtil,
+		ms(res.all.Quantile(0.5)), ms(res.all.Quantile(0.99)), ms(res.all.Quantile(0.999)), res.maxQueue, res.unrouted)
+	tr.log()
+
+	return nil
+}
+
+// latencyTrials repeats a latency run trials times; first is the result of
+// trial 0.
+func latencyTrials(
+	algoEnum rc.Algo,
+	nodes []string,
+	opts rc.Options,
+	wl workloadSpec,
+	lp latencyParams,
+	seed int64,
+	trials int,
+	first latencyResult,
+) (trialSummary, error) {
+	p50 := []float64{ms(first.all.Quantile(0.5))}
+	p99 := []float64{ms(first.all.Quantile(0.99))}
+	p999 := []float64{ms(first.all.Quantile(0.999))}
+	for i := 1; i < trials; i++ {
+		o, keys, weights, err := trialInputs(opts, wl, seed, i)
+		if err != nil {
+			return trialSummary{}, fmt.Errorf("trial %d: %w", i, err)
+		}
+		res, err := simulateLatency(algoEnum, nodes, keys, weights, latencyTimes(wl, keys), o, lp, trialSeed(seed, i))
+		if err != nil {
+			return trialSummary{}, fmt.Errorf("trial %d: %w", i, err)
+		}
+		p50 = append(p50, ms(res.all.Quantile(0.5)))
+		p99 = append(p99, ms(res.all.Quantile(0.99)))
+		p999 = append(p999, ms(res.all.Quantile(0.999)))
+	}
+	return trialSummary{trials: trials, metrics: []trialMetric{
+		{"p50_ms", p50},
+		{"p99_ms", p99},
+		{"p999_ms", p999},
+	}}, nil
+}
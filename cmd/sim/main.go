@@ -1,37 +1,94 @@
 package main
 
 import (
-	"encoding/csv"
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
-	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
 	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/metrics"
 	router "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router/health"
 	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/workload"
 )
 
 func main() {
 	// ----- Flags -----
-	mode := flag.String("mode", "dist", "simulation mode: dist | churn")
-	algo := flag.String("algo", "jump", "routing algorithm: jump | maglev | chbl")
+	mode := flag.String("mode", "dist", "simulation mode: dist | churn | timeline | hashquality | sweep | latency | cache | compare-baseline | bench (ignored with -scenario)")
+	scenarioPath := flag.String("scenario", "", "run a JSON scenario file (cluster, workload, options and event timeline)")
+	algo := flag.String("algo", "jump", "routing algorithm: jump | maglev | chbl | ring | hrw")
 
 	nodesN := flag.Int("nodes", 8, "number of nodes (before churn)")
 	keysN := flag.Int("keys", 100000, "number of keys to simulate")
-	zipfS := flag.Float64("zipf-s", 0.0, "Zipf skew parameter s (0 = uniform)")
+	zipfS := flag.Float64("zipf-s", 0.0, "Zipf skew parameter s: 0 (uniform) or > 1")
+	workloadName := flag.String("workload", "", "synthetic workload instead of uniform/Zipf keys: "+strings.Join(generatorNames(), " | ")+", with optional parameters, e.g. hotspot:hot=5,share=0.9")
+	tracePath := flag.String("trace", "", "replay keys from a trace file (one key per line, or CSV with a key column; may be gzipped) instead of generating them")
 
 	tableSize := flag.Int("table-size", 65537, "Maglev table size (M)")
 	loadFactor := flag.Float64("load-factor", 1.25, "CH-BL load factor c (>=1.0)")
 	vnodes := flag.Int("vnodes", 100, "CH-BL virtual nodes per physical node")
 	walkThreshold := flag.Int("walk-threshold", 8, "CH-BL walk threshold before two-choice fallback")
 
+	hashName := flag.String("hash", "xxh64", "hash function: "+strings.Join(hash.Names(), " | "))
 	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
-	outPath := flag.String("out", "", "output CSV file path (default stdout)")
+	trials := flag.Int("trials", 1, "repeat dist/churn runs with seeds derived from -seed and report mean, stddev and 95% CI")
+	outPath := flag.String("out", "", "output file path (default stdout)")
+	format := flag.String("format", formatCSV, "output format: csv | json | ndjson")
 
-	churnOp := flag.String("churn-op", "", "churn operation in churn mode: add | remove")
+	churnOp := flag.String("churn-op", "", "churn operation in churn mode: add | remove | drain | flap | zone-fail")
+	removeNode := flag.String("remove-node", "", "remove/drain/flap: comma-separated node IDs to act on (default the last node)")
+	removeRandom := flag.Int("remove-random", 0, "remove/drain/flap: act on this many nodes picked at random from -seed")
+	removeEach := flag.Bool("remove-each", false, "remove/drain/flap: repeat the churn once per node and report the moved ratio of each")
+
+	timeline := flag.String("timeline", "rolling-restart", "timeline and cache modes: rolling-restart | scale-out | random-failures")
+	scaleTo := flag.Int("scale-to", 64, "timeline scale-out: final node count")
+	scaleStep := flag.Int("scale-step", 8, "timeline scale-out: nodes added per step")
+	failures := flag.Int("failures", 4, "timeline random-failures: nodes removed, one per step")
+
+	zones := flag.Int("zones", 0, "spread nodes round-robin over this many zones (0 = no zone labels)")
+	replicas := flag.Int("replicas", 3, "replica set size used for availability checks (ring, hrw)")
+	spread := flag.String("spread", "zone", "failure domain replicas are spread across: zone | rack | host | none")
+	failZone := flag.String("fail-zone", "zone-0", "zone removed by -churn-op zone-fail")
+
+	hqHashes := flag.String("hq-hashes", "all", "hashquality: comma-separated hash functions, or 'all'")
+	hqPatterns := flag.String("hq-patterns", "sequential,uuid,shortint", "hashquality: comma-separated key patterns")
+	hqBuckets := flag.Int("hq-buckets", 1024, "hashquality: buckets for the chi-square test")
+	hqSamples := flag.Int("hq-samples", 200, "hashquality: keys sampled for avalanche/BIC tests")
+
+	sweepAlgos := flag.String("sweep-algos", "jump,maglev,chbl,ring,hrw", "sweep: comma-separated algorithms")
+	sweepNodes := flag.String("sweep-nodes", "", "sweep: node counts, e.g. 8,16 or 8:64:8 (default -nodes)")
+	sweepKeys := flag.String("sweep-keys", "", "sweep: key counts (default -keys)")
+	sweepZipf := flag.String("sweep-zipf-s", "", "sweep: Zipf s values, e.g. 0,1.1:1.5:0.2 (default -zipf-s)")
+	sweepVnodes := flag.String("sweep-vnodes", "", "sweep: vnodes per node for chbl/ring (default -vnodes)")
+	sweepLoadFactor := flag.String("sweep-load-factor", "", "sweep: CH-BL load factors (default -load-factor)")
+	sweepTableSize := flag.String("sweep-table-size", "", "sweep: Maglev table sizes (default -table-size)")
+	sweepWalk := flag.String("sweep-walk-threshold", "", "sweep: CH-BL walk thresholds (default -walk-threshold)")
+	parallel := flag.Int("parallel", runtime.NumCPU(), "sweep: configurations run concurrently")
+
+	serviceRate := flag.Float64("service-rate", 1000, "latency: requests per second one server completes")
+	concurrency := flag.Int("concurrency", 1, "latency: servers (requests in service at once) per node")
+	serviceDist := flag.String("service", "exp", "latency: service time distribution: exp | const")
+	arrivalRate := flag.Float64("arrival-rate", 0, "latency: Poisson arrivals per second over the cluster (0 = from -utilization)")
+	utilization := flag.Float64("utilization", 0.7, "latency: offered load per server when -arrival-rate is 0")
+	timeUnit := flag.Float64("trace-time-unit", 1, "latency: seconds per trace timestamp unit (e.g. 0.001 for ms)")
+
+	cacheSize := flag.Int("cache-size", 1000, "cache: keys held by each node's LRU cache")
+	cacheWindow := flag.Int("cache-window", 1000, "cache: requests measured before and after each membership change")
+
+	baselineGlob := flag.String("baseline", "results/*.csv", "compare-baseline: CSV result files to rerun and compare against")
+	tolCV := flag.Float64("tol-cv", 0.05, "compare-baseline: allowed relative increase of cv")
+	tolMax := flag.Float64("tol-max", 0.02, "compare-baseline: allowed relative increase of the max node load")
+	tolMoved := flag.Float64("tol-moved", 0.05, "compare-baseline: allowed relative increase of moved_ratio")
+
+	benchNodes := flag.String("bench-nodes", "8,100,1000,10000", "bench: node counts, e.g. 8,100,1000 or 8:64:8")
+	benchProcs := flag.String("bench-procs", "", "bench: GOMAXPROCS values for parallel Pick throughput (default 1,2,4,... up to the CPU count)")
+	benchTime := flag.Duration("bench-time", 200*time.Millisecond, "bench: time spent on each measurement")
 
 	flag.Parse()
 
@@ -41,14 +98,140 @@ func main() {
 	if *keysN <= 0 {
 		log.Fatalf("keys must be > 0")
 	}
+	switch *format {
+	case formatCSV, formatJSON, formatNDJSON:
+	default:
+		log.Fatalf("format must be 'csv', 'json' or 'ndjson'")
+	}
+	if *trials < 1 {
+		log.Fatalf("trials must be >= 1")
+	}
 	if *loadFactor < 1.0 {
 		log.Fatalf("load-factor must be >= 1.0 for CH-BL")
 	}
-	if *mode != "dist" && *mode != "churn" {
-		log.Fatalf("mode must be 'dist' or 'churn'")
+	switch *mode {
+	case "dist", "churn", "timeline", "hashquality", "sweep", "latency", "cache", "compare-baseline", "bench":
+	default:
+		log.Fatalf("mode must be 'dist', 'churn', 'timeline', 'hashquality', 'sweep', 'latency', 'cache', 'compare-baseline' or 'bench'")
+	}
+	switch *churnOp {
+	case "add", "remove", "drain", "flap", "zone-fail":
+	case "":
+		if *mode == "churn" {
+			log.Fatalf("in churn mode, -churn-op must be 'add', 'remove', 'drain', 'flap' or 'zone-fail'")
+		}
+	default:
+		if *mode == "churn" || *mode == "sweep" {
+			log.Fatalf("in %s mode, -churn-op must be 'add', 'remove', 'drain', 'flap' or 'zone-fail'", *mode)
+		}
+	}
+	if *removeRandom < 0 {
+		log.Fatalf("remove-random must be >= 0")
+	}
+	targetFlags := 0
+	for _, set := range []bool{*removeNode != "", *removeRandom > 0, *removeEach} {
+		if set {
+			targetFlags++
+		}
+	}
+	if targetFlags > 1 {
+		log.Fatalf("-remove-node, -remove-random and -remove-each are mutually exclusive")
+	}
+	if targetFlags > 0 {
+		switch *churnOp {
+		case "remove", "drain", "flap":
+		default:
+			log.Fatalf("-remove-node, -remove-random and -remove-each need -churn-op remove, drain or flap")
+		}
+	}
+	if *removeEach && (*mode != "churn" || *trials > 1) {
+		log.Fatalf("-remove-each runs in churn mode with a single trial")
+	}
+	if *churnOp == "zone-fail" && *zones <= 0 {
+		log.Fatalf("-churn-op zone-fail requires -zones > 0")
+	}
+	if _, err := hash.ByName(*hashName); err != nil {
+		log.Fatalf("unknown hash %q (expected %s)", *hashName, strings.Join(hash.Names(), "|"))
 	}
-	if *mode == "churn" && (*churnOp != "add" && *churnOp != "remove") {
-		log.Fatalf("in churn mode, -churn-op must be 'add' or 'remove'")
+	if *zones < 0 {
+		log.Fatalf("zones must be >= 0")
+	}
+	if *replicas <= 0 {
+		log.Fatalf("replicas must be > 0")
+	}
+	if *parallel <= 0 {
+		log.Fatalf("parallel must be > 0")
+	}
+	if *scaleStep <= 0 || *failures <= 0 {
+		log.Fatalf("scale-step and failures must be > 0")
+	}
+	if *serviceRate <= 0 || *concurrency <= 0 || *timeUnit <= 0 {
+		log.Fatalf("service-rate, concurrency and trace-time-unit must be > 0")
+	}
+	if *arrivalRate < 0 || (*arrivalRate == 0 && *utilization <= 0) {
+		log.Fatalf("arrival-rate must be >= 0, and utilization > 0 when it is 0")
+	}
+	if *serviceDist != "exp" && *serviceDist != "const" {
+		log.Fatalf("service must be 'exp' or 'const'")
+	}
+	if *cacheSize <= 0 || *cacheWindow <= 0 {
+		log.Fatalf("cache-size and cache-window must be > 0")
+	}
+	if *tolCV < 0 || *tolMax < 0 || *tolMoved < 0 {
+		log.Fatalf("tol-cv, tol-max and tol-moved must be >= 0")
+	}
+	if *benchTime <= 0 {
+		log.Fatalf("bench-time must be > 0")
+	}
+
+	dest := output{path: *outPath, format: *format, mode: *mode}
+
+	if *mode == "compare-baseline" {
+		// every configuration comes from the baseline files
+		bp := baselineParams{glob: *baselineGlob, tolCV: *tolCV, tolMax: *tolMax, tolMoved: *tolMoved}
+		regressions, err := runCompareBaseline(bp, dest)
+		if err != nil {
+			log.Fatalf("compare-baseline: %v", err)
+		}
+		if regressions > 0 {
+			log.Fatalf("compare-baseline: %d metric(s) regressed", regressions)
+		}
+		return
+	}
+
+	spreadDomain, err := parseDomain(*spread)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *zones == 0 {
+		spreadDomain = rc.DomainNone // no labels to spread across
+	}
+
+	// ----- Workload -----
+	if err := checkZipfS(*zipfS); err != nil {
+		log.Fatalf("-zipf-s: %v", err)
+	}
+	wl := workloadSpec{keys: *keysN, zipfS: *zipfS}
+	if *workloadName != "" {
+		if *tracePath != "" {
+			log.Fatalf("-workload and -trace are mutually exclusive")
+		}
+		if wl.gen, err = parseGenerator(*workloadName); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *tracePath != "" {
+		if wl.trace, err = workload.LoadTrace(*tracePath); err != nil {
+			log.Fatalf("trace: %v", err)
+		}
+		wl.tracePath = *tracePath
+		// replay the whole trace unless -keys is given explicitly
+		wl.keys = 0
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "keys" {
+				wl.keys = *keysN
+			}
+		})
 	}
 
 	// ----- Nodes (before churn) -----
@@ -58,18 +241,9 @@ func main() {
 	}
 
 	// ----- Algo enum -----
-	var algoEnum rc.Algo
-	switch *algo {
-	case "jump":
-		algoEnum = rc.AlgoJump
-	case "maglev":
-		algoEnum = rc.AlgoMaglev
-	case "chbl":
-		algoEnum = rc.AlgoCHBL
-	case "ring":
-		algoEnum = rc.AlgoRing
-	default:
-		log.Fatalf("unknown algo %q (expected jump|maglev|chbl)", *algo)
+	algoEnum, err := parseAlgo(*algo)
+	if err != nil && *scenarioPath == "" {
+		log.Fatalf("%v", err)
 	}
 
 	// ----- Router options -----
@@ -79,34 +253,295 @@ func main() {
 		Vnodes:        *vnodes,
 		WalkThreshold: *walkThreshold,
 		HashSeed:      uint64(*seed),
+		HashFunc:      *hashName,
 		ExpectedKeys:  *keysN, // CH-BL uses this; others ignore it
+		// label one extra node so churn "add" gets a zone as well
+		Topology:      buildTopology(*nodesN+1, *zones),
+		ReplicaSpread: spreadDomain,
+	}
+
+	if *mode == "hashquality" {
+		hq := hashQualityParams{
+			hashes:   splitList(*hqHashes),
+			patterns: splitList(*hqPatterns),
+			keys:     *keysN,
+			buckets:  *hqBuckets,
+			samples:  *hqSamples,
+		}
+		if err := runHashQuality(hq, *seed, dest); err != nil {
+			log.Fatalf("hashquality run failed: %v", err)
+		}
+		return
+	}
+
+	if *scenarioPath != "" {
+		sc, err := loadScenario(*scenarioPath)
+		if err != nil {
+			log.Fatalf("scenario: %v", err)
+		}
+		if wl.trace != nil {
+			// -trace replaces the scenario's workload
+			sc.Workload = scenarioWorkload{Keys: wl.keys, Trace: wl.tracePath}
+			sc.trace, sc.gen = wl.trace, nil
+		}
+		if wl.gen != nil {
+			sc.Workload.Generator, sc.Workload.Trace = wl.gen.String(), ""
+			sc.gen, sc.trace = wl.gen, nil
+		}
+		if err := runScenario(sc, opts, *seed, dest); err != nil {
+			log.Fatalf("scenario run failed: %v", err)
+		}
+		return
+	}
+
+	if *mode == "timeline" || *mode == "cache" {
+		tp := timelineParams{
+			kind:      *timeline,
+			scaleTo:   *scaleTo,
+			scaleStep: *scaleStep,
+			failures:  *failures,
+		}
+		sc, err := timelineScenario(*algo, *nodesN, wl, *zones, tp, *seed)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if *mode == "cache" {
+			wl.algo, wl.nodes, wl.opts = algoEnum, nodesBefore, opts
+			cp := cacheParams{size: *cacheSize, window: *cacheWindow}
+			if err := runCache(*algo, algoEnum, sc, opts, wl, cp, *seed, dest); err != nil {
+				log.Fatalf("cache run failed: %v", err)
+			}
+			return
+		}
+		if err := runScenario(sc, opts, *seed, dest); err != nil {
+			log.Fatalf("timeline run failed: %v", err)
+		}
+		return
+	}
+
+	if *mode == "sweep" {
+		sp := sweepParams{
+			algos:          splitList(*sweepAlgos),
+			nodes:          mustIntList("sweep-nodes", *sweepNodes, *nodesN),
+			keys:           mustIntList("sweep-keys", *sweepKeys, *keysN),
+			zipfS:          mustZipfList("sweep-zipf-s", *sweepZipf, *zipfS),
+			vnodes:         mustIntList("sweep-vnodes", *sweepVnodes, *vnodes),
+			loadFactors:    mustFloatList("sweep-load-factor", *sweepLoadFactor, *loadFactor),
+			tableSizes:     mustIntList("sweep-table-size", *sweepTableSize, *tableSize),
+			walkThresholds: mustIntList("sweep-walk-threshold", *sweepWalk, *walkThreshold),
+			churn: churnParams{
+				op:           *churnOp,
+				zones:        *zones,
+				failZone:     *failZone,
+				replicas:     *replicas,
+				targets:      splitList(*removeNode),
+				randomTarget: *removeRandom,
+			},
+			replay:   wl,
+			zones:    *zones,
+			trials:   *trials,
+			parallel: *parallel,
+		}
+		for _, lf := range sp.loadFactors {
+			if lf < 1.0 {
+				log.Fatalf("-sweep-load-factor values must be >= 1.0")
+			}
+		}
+		if err := runSweep(sp, opts, *seed, dest); err != nil {
+			log.Fatalf("sweep run failed: %v", err)
+		}
+		return
 	}
 
 	// ----- Pre-generate keys (so both phases use identical keys) -----
-	keys := generateKeys(*keysN, *zipfS, *seed)
+	wl.algo, wl.nodes, wl.opts = algoEnum, nodesBefore, opts
+	keys, weights, err := wl.requests(*seed)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	opts = sizedFor(opts, keys, weights)
 
 	// ----- Run appropriate mode -----
 	switch *mode {
 	case "dist":
-		if err := runDistribution(*algo, algoEnum, nodesBefore, keys, opts, *zipfS, *seed, *outPath); err != nil {
+		if err := runDistribution(*algo, algoEnum, nodesBefore, keys, weights, opts, wl, *seed, *trials, dest); err != nil {
 			log.Fatalf("distribution run failed: %v", err)
 		}
+	case "latency":
+		lp := latencyParams{
+			serviceRate: *serviceRate,
+			concurrency: *concurrency,
+			service:     *serviceDist,
+			arrivalRate: *arrivalRate,
+			utilization: *utilization,
+			timeUnit:    *timeUnit,
+		}
+		if err := runLatency(*algo, algoEnum, nodesBefore, keys, weights, opts, wl, lp, *seed, *trials, dest); err != nil {
+			log.Fatalf("latency run failed: %v", err)
+		}
+	case "bench":
+		procs := defaultBenchProcs(runtime.NumCPU())
+		if *benchProcs != "" {
+			procs = mustIntList("bench-procs", *benchProcs, 1)
+		}
+		bp := benchParams{
+			grid: sweepParams{
+				algos:          splitList(*sweepAlgos),
+				nodes:          mustIntList("bench-nodes", *benchNodes, *nodesN),
+				vnodes:         mustIntList("sweep-vnodes", *sweepVnodes, *vnodes),
+				loadFactors:    mustFloatList("sweep-load-factor", *sweepLoadFactor, *loadFactor),
+				tableSizes:     mustIntList("sweep-table-size", *sweepTableSize, *tableSize),
+				walkThresholds: mustIntList("sweep-walk-threshold", *sweepWalk, *walkThreshold),
+				zones:          *zones,
+			},
+			procs: procs,
+			time:  *benchTime,
+		}
+		if err := runBench(bp, opts, keys, wl, *seed, dest); err != nil {
+			log.Fatalf("bench run failed: %v", err)
+		}
 	case "churn":
-		if err := runChurn(*algo, algoEnum, nodesBefore, keys, opts, *zipfS, *seed, *churnOp, *outPath); err != nil {
+		cp := churnParams{
+			op:           *churnOp,
+			zones:        *zones,
+			failZone:     *failZone,
+			replicas:     *replicas,
+			targets:      splitList(*removeNode),
+			randomTarget: *removeRandom,
+			targetSeed:   *seed,
+		}
+		if *removeEach {
+			if err := runChurnEach(*algo, algoEnum, nodesBefore, keys, weights, opts, wl, *seed, cp, dest); err != nil {
+				log.Fatalf("churn run failed: %v", err)
+			}
+			return
+		}
+		if err := runChurn(*algo, algoEnum, nodesBefore, keys, weights, opts, wl, *seed, cp, *trials, dest); err != nil {
 			log.Fatalf("churn run failed: %v", err)
 		}
 	}
 }
 
-func generateKeys(keysN int, zipfS float64, seed int64) [][]byte {
+// mustIntList parses a sweep flag, defaulting to the single value def when
+// the flag is empty.
+func mustIntList(name, s string, def int) []int {
+	if strings.TrimSpace(s) == "" {
+		return []int{def}
+	}
+	vals, err := parseIntRange(s)
+	if err != nil {
+		log.Fatalf("-%s: %v", name, err)
+	}
+	for _, v := range vals {
+		if v <= 0 {
+			log.Fatalf("-%s: values must be > 0", name)
+		}
+	}
+	return vals
+}
+
+// mustFloatList is mustIntList for float flags; values must be >= 0.
+func mustFloatList(name, s string, def float64) []float64 {
+	if strings.TrimSpace(s) == "" {
+		return []float64{def}
+	}
+	vals, err := parseFloatRange(s)
+	if err != nil {
+		log.Fatalf("-%s: %v", name, err)
+	}
+	for _, v := range vals {
+		if v < 0 {
+			log.Fatalf("-%s: values must be >= 0", name)
+		}
+	}
+	return vals
+}
+
+// mustZipfList is mustFloatList for Zipf exponents (see checkZipfS).
+func mustZipfList(name, s string, def float64) []float64 {
+	vals := mustFloatList(name, s, def)
+	for _, v := range vals {
+		if err := checkZipfS(v); err != nil {
+			log.Fatalf("-%s: %v", name, err)
+		}
+	}
+	return vals
+}
+
+// parseAlgo maps an -algo name to its routercore.Algo.
+func parseAlgo(name string) (rc.Algo, error) {
+	switch name {
+	case "jump":
+		return rc.AlgoJump, nil
+	case "maglev":
+		return rc.AlgoMaglev, nil
+	case "chbl":
+		return rc.AlgoCHBL, nil
+	case "ring":
+		return rc.AlgoRing, nil
+	case "hrw":
+		return rc.AlgoHRW, nil
+	default:
+		return "", fmt.Errorf("unknown algo %q (expected jump|maglev|chbl|ring|hrw)", name)
+	}
+}
+
+// parseDomain maps a -spread name to its routercore.Domain.
+func parseDomain(name string) (rc.Domain, error) {
+	switch name {
+	case "zone":
+		return rc.DomainZone, nil
+	case "rack":
+		return rc.DomainRack, nil
+	case "host":
+		return rc.DomainHost, nil
+	case "none", "":
+		return rc.DomainNone, nil
+	default:
+		return rc.DomainNone, fmt.Errorf("unknown spread %q (expected zone|rack|host|none)", name)
+	}
+}
+
+// buildTopology labels node-0..node-(n-1) round-robin across zones
+// zone-0..zone-(zones-1). Each node is its own rack and host. Returns nil
+// if zones is zero.
+func buildTopology(n, zones int) rc.Topology {
+	if zones <= 0 {
+		return nil
+	}
+	topo := make(rc.Topology, n)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("node-%d", i)
+		topo[id] = rc.NodeLabels{
+			Zone: fmt.Sprintf("zone-%d", i%zones),
+			Rack: id,
+			Host: id,
+		}
+	}
+	return topo
+}
+
+// checkZipfS rejects Zipf exponents math/rand cannot draw from: s must be
+// 0 (uniform) or > 1, as in pkg/workload.
+func checkZipfS(s float64) error {
+	if s != 0 && s <= 1 {
+		return fmt.Errorf("zipf s must be 0 (uniform) or > 1, got %v", s)
+	}
+	return nil
+}
+
+func generateKeys(keysN int, zipfS float64, seed int64) ([][]byte, error) {
+	if err := checkZipfS(zipfS); err != nil {
+		return nil, err
+	}
 	keys := make([][]byte, keysN)
 	rng := rand.New(rand.NewSource(seed))
 
-	if zipfS <= 0.0 {
+	if zipfS == 0 {
 		for i := 0; i < keysN; i++ {
 			keys[i] = []byte(fmt.Sprintf("key-%d", i))
 		}
-		return keys
+		return keys, nil
 	}
 
 	zipf := rand.NewZipf(rng, zipfS, 1.0, uint64(keysN-1))
@@ -114,56 +549,119 @@ func generateKeys(keysN int, zipfS float64, seed int64) [][]byte {
 		kIdx := zipf.Uint64()
 		keys[i] = []byte(fmt.Sprintf("key-%d", kIdx))
 	}
-	return keys
+	return keys, nil
 }
 
 // ------------------ Distribution mode ------------------
 
+// distResult is the per-node load of one distribution run.
+type distResult struct {
+	perNode []int // keys per node, in nodes order
+	stats   metrics.IntStats
+
+	// total request weight per node, if the requests are weighted
+	weight      []float64
+	weightStats metrics.FloatStats
+}
+
+// simulateDistribution routes keys through a fresh mapper over nodes.
+// weights, if not nil, gives the weight of each key; CH-BL then bounds the
+// weight per node (size it with sizedFor).
+func simulateDistribution(algoEnum rc.Algo, nodes []string, keys [][]byte, weights []float64, opts rc.Options) (distResult, error) {
+	state, err := clusterState(nodes, opts.Topology)
+	if err != nil {
+		return distResult{}, err
+	}
+	mapper, err := state.mapper(algoEnum, opts)
+	if err != nil {
+		return distResult{}, fmt.Errorf("construct mapper: %w", err)
+	}
+
+	// Count per node, indexed by the mapper's node table
+	table := mapper.Nodes()
+	counts := make([]int, len(table))
+	var sums []float64
+	if weights != nil {
+		sums = make([]float64, len(table))
+	}
+	for i := range keys {
+		if idx := pickIndex(mapper, keys, weights, i); idx >= 0 {
+			counts[idx]++
+			if sums != nil {
+				sums[idx] += weights[i]
+			}
+		}
+	}
+
+	res := distResult{perNode: make([]int, len(nodes))} // consistent order
+	var perNodeSums []float64
+	if sums != nil {
+		perNodeSums = make([]float64, len(nodes))
+	}
+	for i, pos := range tablePositions(table, nodes) {
+		if pos < 0 {
+			continue
+		}
+		res.perNode[pos] = counts[i]
+		if sums != nil {
+			perNodeSums[pos] = sums[i]
+		}
+	}
+	res.stats = metrics.ComputeIntStats(res.perNode)
+	if sums != nil {
+		res.weight, res.weightStats = perNodeSums, metrics.ComputeFloatStats(perNodeSums)
+	}
+	return res, nil
+}
+
 func runDistribution(
 	algoName string,
 	algoEnum rc.Algo,
 	nodes []string,
 	keys [][]byte,
+	weights []float64,
 	opts rc.Options,
-	zipfS float64,
+	wl workloadSpec,
 	seed int64,
-	outPath string,
-) error {
-	mapper, err := router.New(algoEnum, opts, nodes)
+	trials int,
+	dest output,
+) (err error) {
+	res, err := simulateDistribution(algoEnum, nodes, keys, weights, opts)
 	if err != nil {
-		return fmt.Errorf("construct mapper: %w", err)
-	}
-
-	// Count per node
-	counts := make(map[string]int, len(nodes))
-	for _, k := range keys {
-		n := mapper.Pick(k)
-		counts[n]++
+		return err
 	}
+	perNode, stats := res.perNode, res.stats
 
-	perNode := make([]int, 0, len(nodes))
-	for _, id := range nodes {
-		perNode = append(perNode, counts[id]) // consistent order
+	var trialRows [][]string
+	var tr trialSummary
+	if trials > 1 {
+		if tr, err = distTrials(algoEnum, nodes, opts, wl, seed, trials, res); err != nil {
+			return err
+		}
+		trialRows = tr.rows()
 	}
-	stats := metrics.ComputeIntStats(perNode)
 
-	out, w, err := createCSVWriter(outPath)
+	out, w, err := createWriter(dest)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	defer w.Flush()
+	defer closeOutput(out, w, &err)
 
 	// Header
-	if err := w.Write([]string{"node_id", "count"}); err != nil {
+	header := []string{"node_id", "count"}
+	if res.weight != nil {
+		header = append(header, "weight")
+	}
+	if err := w.Write(header); err != nil {
 		return fmt.Errorf("write header: %w", err)
 	}
 	// Rows
 	for i, id := range nodes {
-		if err := w.Write([]string{
-			id,
-			fmt.Sprintf("%d", perNode[i]),
-		}); err != nil {
+		row := []string{id, fmt.Sprintf("%d", perNode[i])}
+		if res.weight != nil {
+			row = append(row, fmt.Sprintf("%.3f", res.weight[i]))
+		}
+		if err := w.Write(row); err != nil {
 			return fmt.Errorf("write row: %w", err)
 		}
 	}
@@ -174,17 +672,27 @@ func runDistribution(
 		{"#algo", algoName},
 		{"#nodes", fmt.Sprintf("%d", len(nodes))},
 		{"#keys", fmt.Sprintf("%d", len(keys))},
-		{"#zipf_s", fmt.Sprintf("%.3f", zipfS)},
+	}
+	summaryRows = append(summaryRows, wl.rows()...)
+	summaryRows = append(summaryRows, [][]string{
 		{"#table_size", fmt.Sprintf("%d", opts.TableSize)},
 		{"#load_factor", fmt.Sprintf("%.3f", opts.LoadFactor)},
 		{"#vnodes", fmt.Sprintf("%d", opts.Vnodes)},
 		{"#walk_threshold", fmt.Sprintf("%d", opts.WalkThreshold)},
 		{"#seed", fmt.Sprintf("%d", seed)},
+		{"#hash", hashFuncName(opts)},
 		{"#mean", fmt.Sprintf("%.3f", stats.Mean)},
 		{"#max", fmt.Sprintf("%d", stats.Max)},
 		{"#std", fmt.Sprintf("%.3f", stats.Std)},
 		{"#cv", fmt.Sprintf("%.5f", stats.CV)},
+	}...)
+	summaryRows = append(summaryRows, fairnessRows(stats.Float(), "")...)
+	// every node is a target in dist mode, so this equals kl_uniform
+	summaryRows = append(summaryRows, []string{"#kl_target", fmt.Sprintf("%.6f", metrics.KLDivergence(perNode, nil))})
+	if res.weight != nil {
+		summaryRows = append(summaryRows, weightRows(res.weightStats, "_weight")...)
 	}
+	summaryRows = append(summaryRows, trialRows...)
 
 	for _, row := range summaryRows {
 		if err := w.Write(row); err != nil {
@@ -192,25 +700,156 @@ func runDistribution(
 		}
 	}
 
-	log.Printf("mode=dist algo=%s nodes=%d keys=%d zipf_s=%.2f mean=%.2f max=%d cv=%.4f",
-		algoName, len(nodes), len(keys), zipfS, stats.Mean, stats.Max, stats.CV)
+	log.Printf("mode=dist algo=%s hash=%s nodes=%d keys=%d %s mean=%.2f max=%d cv=%.4f",
+		algoName, hashFuncName(opts), len(nodes), len(keys), wl, stats.Mean, stats.Max, stats.CV)
+	if res.weight != nil {
+		log.Printf("weight total=%.1f mean=%.2f max=%.1f cv=%.4f max_avg=%.4f",
+			res.weightStats.Sum, res.weightStats.Mean, res.weightStats.Max, res.weightStats.CV, res.weightStats.MaxAvg)
+	}
+	tr.log()
 
 	return nil
 }
 
 // ------------------ Churn mode ------------------
 
-func runChurn(
-	algoName string,
+// churnParams describes the membership change applied in churn mode.
+type churnParams struct {
+	op       string // add | remove | drain | flap | zone-fail
+	zones    int    // number of zones nodes are labeled with (0 = none)
+	failZone string // zone removed by zone-fail
+	replicas int    // replica set size for availability accounting
+
+	// nodes removed, drained or flapped; the last node if neither is set
+	targets      []string
+	randomTarget int   // pick this many random targets instead
+	targetSeed   int64 // seed for randomTarget
+}
+
+// churnTargets resolves the nodes a remove, drain or flap applies to.
+func churnTargets(nodes []string, cp churnParams) ([]string, error) {
+	switch {
+	case cp.randomTarget > 0:
+		if cp.randomTarget >= len(nodes) {
+			return nil, fmt.Errorf("cannot pick %d random nodes out of %d", cp.randomTarget, len(nodes))
+		}
+		rng := rand.New(rand.NewSource(cp.targetSeed))
+		var out []string
+		for _, i := range rng.Perm(len(nodes))[:cp.randomTarget] {
+			out = append(out, nodes[i])
+		}
+		return out, nil
+	case len(cp.targets) > 0:
+		member := make(map[string]bool, len(nodes))
+		for _, n := range nodes {
+			member[n] = true
+		}
+		seen := make(map[string]bool, len(cp.targets))
+		for _, t := range cp.targets {
+			if !member[t] {
+				return nil, fmt.Errorf("node %q is not in the cluster", t)
+			}
+			if seen[t] {
+				return nil, fmt.Errorf("node %q listed twice", t)
+			}
+			seen[t] = true
+		}
+		if len(cp.targets) >= len(nodes) {
+			return nil, fmt.Errorf("cannot %s every node", cp.op)
+		}
+		return cp.targets, nil
+	default:
+		return nodes[len(nodes)-1:], nil
+	}
+}
+
+// without returns nodes minus the given IDs, preserving order.
+func without(nodes, drop []string) []string {
+	skip := make(map[string]bool, len(drop))
+	for _, d := range drop {
+		skip[d] = true
+	}
+	var out []string
+	for _, n := range nodes {
+		if !skip[n] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// churnResult is the outcome of one churn simulation.
+type churnResult struct {
+	nodesAfter []string
+	nodeList   []string // nodes before, then any added ones
+	targets    []string // nodes removed, drained or flapped
+
+	// keys per node before and after the churn, in nodeList order
+	perBefore   []int
+	perAfter    []int
+	total       int // keys routed
+	moved       int
+	statsBefore metrics.IntStats
+	statsAfter  metrics.IntStats
+
+	// KL divergence from an equal share on every node that can take keys
+	// (removed, drained and unhealthy nodes have a target of zero)
+	klTargetBefore float64
+	klTargetAfter  float64
+
+	// the same by request weight, if the requests are weighted
+	weighted          bool
+	weightBefore      []float64
+	weightAfter       []float64
+	totalWeight       float64
+	movedWeight       float64
+	weightStatsBefore metrics.FloatStats
+	weightStatsAfter  metrics.FloatStats
+
+	avail     int  // keys that kept a live replica
+	haveAvail bool // false if the mapper cannot pick replica sets
+	dc        drainComparison
+	fc        flapComparison
+}
+
+// movedRatio is the fraction of keys whose node changed.
+func (r churnResult) movedRatio() float64 {
+	return float64(r.moved) / float64(r.total)
+}
+
+// movedWeightRatio is the fraction of request weight whose node changed.
+func (r churnResult) movedWeightRatio() float64 {
+	if r.totalWeight == 0 {
+		return 0
+	}
+	return r.movedWeight / r.totalWeight
+}
+
+// simulateChurn routes keys through mappers for the cluster before and
+// after the membership change described by cp. weights, if not nil, gives
+// the weight of each key, as in simulateDistribution.
+func simulateChurn(
 	algoEnum rc.Algo,
 	nodesBefore []string,
 	keys [][]byte,
+	weights []float64,
 	opts rc.Options,
-	zipfS float64,
-	seed int64,
-	churnOp string,
-	outPath string,
-) error {
+	cp churnParams,
+) (churnResult, error) {
+	churnOp := cp.op
+
+	var targets []string
+	switch churnOp {
+	case "remove", "drain", "flap":
+		if len(nodesBefore) <= 1 {
+			return churnResult{}, fmt.Errorf("cannot %s a node of a single-node cluster", churnOp)
+		}
+		var err error
+		if targets, err = churnTargets(nodesBefore, cp); err != nil {
+			return churnResult{}, err
+		}
+	}
+
 	// Build nodesAfter
 	var nodesAfter []string
 	switch churnOp {
@@ -219,41 +858,53 @@ func runChurn(
 		newID := fmt.Sprintf("node-%d", len(nodesBefore))
 		nodesAfter = append(nodesAfter, newID)
 	case "remove":
-		if len(nodesBefore) <= 1 {
-			return fmt.Errorf("cannot remove from single-node cluster")
+		nodesAfter = without(nodesBefore, targets)
+	case "drain", "flap":
+		// membership is unchanged; targets are drained or marked
+		// unhealthy below
+		nodesAfter = append([]string{}, nodesBefore...)
+	case "zone-fail":
+		for _, n := range nodesBefore {
+			if opts.Topology.DomainOf(n, rc.DomainZone) != cp.failZone {
+				nodesAfter = append(nodesAfter, n)
+			}
+		}
+		if len(nodesAfter) == len(nodesBefore) {
+			return churnResult{}, fmt.Errorf("zone %q has no nodes", cp.failZone)
+		}
+		if len(nodesAfter) == 0 {
+			return churnResult{}, fmt.Errorf("zone %q holds every node; nothing would survive", cp.failZone)
 		}
-		nodesAfter = append([]string{}, nodesBefore[:len(nodesBefore)-1]...)
 	default:
-		return fmt.Errorf("unknown churn-op %q", churnOp)
+		return churnResult{}, fmt.Errorf("unknown churn-op %q", churnOp)
 	}
 
-	// Mapper before churn
-	mapperBefore, err := router.New(algoEnum, opts, nodesBefore)
+	// The churn as a two-step scenario: the cluster before, then one event
+	var event scenarioStep
+	switch churnOp {
+	case "add":
+		event = clusterStep("add", nodesAfter[len(nodesBefore):], opts.Topology)
+	case "remove", "drain":
+		event = clusterStep(churnOp, targets, opts.Topology)
+	case "flap":
+		event = clusterStep("fail", targets, opts.Topology)
+	case "zone-fail":
+		event = clusterStep("remove", without(nodesBefore, nodesAfter), opts.Topology)
+	}
+	state, err := clusterState(nodesBefore, opts.Topology)
 	if err != nil {
-		return fmt.Errorf("construct mapper(before): %w", err)
+		return churnResult{}, err
 	}
-	// Mapper after churn
-	mapperAfter, err := router.New(algoEnum, opts, nodesAfter)
+	mapperBefore, err := state.mapper(algoEnum, opts)
 	if err != nil {
-		return fmt.Errorf("construct mapper(after): %w", err)
+		return churnResult{}, fmt.Errorf("construct mapper(before): %w", err)
 	}
-
-	countsBefore := make(map[string]int, len(nodesBefore))
-	countsAfter := make(map[string]int, len(nodesAfter))
-
-	moved := 0
-	total := len(keys)
-
-	for _, k := range keys {
-		nb := mapperBefore.Pick(k)
-		na := mapperAfter.Pick(k)
-
-		countsBefore[nb]++
-		countsAfter[na]++
-
-		if nb != na {
-			moved++
-		}
+	if err := state.apply(event); err != nil {
+		return churnResult{}, fmt.Errorf("churn: %w", err)
+	}
+	mapperAfter, err := state.mapper(algoEnum, opts)
+	if err != nil {
+		return churnResult{}, fmt.Errorf("construct mapper(after): %w", err)
 	}
 
 	// Build unified node list: all nodes before, then any new ones
@@ -272,36 +923,161 @@ func runChurn(
 		}
 	}
 
+	// Translate each mapper's node indices into nodeList positions once,
+	// so the per-key loop works on slices only.
+	posBefore := tablePositions(mapperBefore.Nodes(), nodeList)
+	posAfter := tablePositions(mapperAfter.Nodes(), nodeList)
+
 	perBefore := make([]int, len(nodeList))
 	perAfter := make([]int, len(nodeList))
-	for i, n := range nodeList {
-		perBefore[i] = countsBefore[n]
-		perAfter[i] = countsAfter[n]
+	var sumBefore, sumAfter []float64
+	if weights != nil {
+		sumBefore = make([]float64, len(nodeList))
+		sumAfter = make([]float64, len(nodeList))
+	}
+
+	moved := 0
+	var totalWeight, movedWeight float64
+
+	for i := range keys {
+		nb := listPosition(posBefore, pickIndex(mapperBefore, keys, weights, i))
+		na := listPosition(posAfter, pickIndex(mapperAfter, keys, weights, i))
+
+		if nb >= 0 {
+			perBefore[nb]++
+		}
+		if na >= 0 {
+			perAfter[na]++
+		}
+
+		if nb != na {
+			moved++
+		}
+
+		if weights != nil {
+			w := weights[i]
+			totalWeight += w
+			if nb >= 0 {
+				sumBefore[nb] += w
+			}
+			if na >= 0 {
+				sumAfter[na] += w
+			}
+			if nb != na {
+				movedWeight += w
+			}
+		}
 	}
 
 	statsBefore := metrics.ComputeIntStats(perBefore)
 	statsAfter := metrics.ComputeIntStats(perAfter)
+	var excluded []string
+	if churnOp == "drain" || churnOp == "flap" {
+		excluded = targets
+	}
+	klTargetBefore := metrics.KLDivergence(perBefore, targetShares(nodeList, nodesBefore, nil))
+	klTargetAfter := metrics.KLDivergence(perAfter, targetShares(nodeList, nodesAfter, excluded))
 
-	movedRatio := float64(moved) / float64(total)
+	// Replica availability: how many keys keep at least one live replica
+	// from the replica set they had before the churn.
+	avail, haveAvail := replicaAvailability(mapperBefore, keys, nodesAfter, cp.replicas)
 
-	out, w, err := createCSVWriter(outPath)
+	var dc drainComparison
+	var fc flapComparison
+	switch churnOp {
+	case "drain":
+		dc, err = compareDrainToRemove(algoEnum, opts, nodesBefore, targets, keys)
+	case "flap":
+		fc, err = compareFlap(algoEnum, opts, nodesBefore, targets, keys)
+	}
+	if err != nil {
+		return churnResult{}, err
+	}
+
+	res := churnResult{
+		nodesAfter:     nodesAfter,
+		nodeList:       nodeList,
+		targets:        targets,
+		perBefore:      perBefore,
+		perAfter:       perAfter,
+		total:          len(keys),
+		moved:          moved,
+		statsBefore:    statsBefore,
+		statsAfter:     statsAfter,
+		klTargetBefore: klTargetBefore,
+		klTargetAfter:  klTargetAfter,
+		avail:          avail,
+		haveAvail:      haveAvail,
+		dc:             dc,
+		fc:             fc,
+	}
+	if weights != nil {
+		res.weighted = true
+		res.totalWeight, res.movedWeight = totalWeight, movedWeight
+		res.weightBefore, res.weightStatsBefore = sumBefore, metrics.ComputeFloatStats(sumBefore)
+		res.weightAfter, res.weightStatsAfter = sumAfter, metrics.ComputeFloatStats(sumAfter)
+	}
+	return res, nil
+}
+
+func runChurn(
+	algoName string,
+	algoEnum rc.Algo,
+	nodesBefore []string,
+	keys [][]byte,
+	weights []float64,
+	opts rc.Options,
+	wl workloadSpec,
+	seed int64,
+	cp churnParams,
+	trials int,
+	dest output,
+) (err error) {
+	res, err := simulateChurn(algoEnum, nodesBefore, keys, weights, opts, cp)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	defer w.Flush()
+	churnOp := cp.op
+	total := res.total
+	movedRatio := res.movedRatio()
+
+	var trialRows [][]string
+	var tr trialSummary
+	if trials > 1 {
+		if tr, err = churnTrials(algoEnum, nodesBefore, opts, wl, seed, cp, trials, res); err != nil {
+			return err
+		}
+		trialRows = tr.rows()
+	}
+
+	out, w, err := createWriter(dest)
+	if err != nil {
+		return err
+	}
+	defer closeOutput(out, w, &err)
 
 	// Header
-	if err := w.Write([]string{"node_id", "count_before", "count_after"}); err != nil {
+	header := []string{"node_id", "count_before", "count_after"}
+	if res.weighted {
+		header = append(header, "weight_before", "weight_after")
+	}
+	if err := w.Write(header); err != nil {
 		return fmt.Errorf("write header: %w", err)
 	}
 	// Rows
-	for i, n := range nodeList {
-		if err := w.Write([]string{
+	for i, n := range res.nodeList {
+		row := []string{
 			n,
-			fmt.Sprintf("%d", perBefore[i]),
-			fmt.Sprintf("%d", perAfter[i]),
-		}); err != nil {
+			fmt.Sprintf("%d", res.perBefore[i]),
+			fmt.Sprintf("%d", res.perAfter[i]),
+		}
+		if res.weighted {
+			row = append(row,
+				fmt.Sprintf("%.3f", res.weightBefore[i]),
+				fmt.Sprintf("%.3f", res.weightAfter[i]),
+			)
+		}
+		if err := w.Write(row); err != nil {
 			return fmt.Errorf("write row: %w", err)
 		}
 	}
@@ -312,23 +1088,80 @@ func runChurn(
 		{"#algo", algoName},
 		{"#churn_op", churnOp},
 		{"#nodes_before", fmt.Sprintf("%d", len(nodesBefore))},
-		{"#nodes_after", fmt.Sprintf("%d", len(nodesAfter))},
+		{"#nodes_after", fmt.Sprintf("%d", len(res.nodesAfter))},
 		{"#keys", fmt.Sprintf("%d", total)},
-		{"#moved", fmt.Sprintf("%d", moved)},
+		{"#moved", fmt.Sprintf("%d", res.moved)},
 		{"#moved_ratio", fmt.Sprintf("%.6f", movedRatio)},
-		{"#zipf_s", fmt.Sprintf("%.3f", zipfS)},
+	}
+	summaryRows = append(summaryRows, wl.rows()...)
+	summaryRows = append(summaryRows, [][]string{
 		{"#table_size", fmt.Sprintf("%d", opts.TableSize)},
 		{"#load_factor", fmt.Sprintf("%.3f", opts.LoadFactor)},
 		{"#vnodes", fmt.Sprintf("%d", opts.Vnodes)},
 		{"#walk_threshold", fmt.Sprintf("%d", opts.WalkThreshold)},
 		{"#seed", fmt.Sprintf("%d", seed)},
-		{"#mean_before", fmt.Sprintf("%.3f", statsBefore.Mean)},
-		{"#max_before", fmt.Sprintf("%d", statsBefore.Max)},
-		{"#cv_before", fmt.Sprintf("%.5f", statsBefore.CV)},
-		{"#mean_after", fmt.Sprintf("%.3f", statsAfter.Mean)},
-		{"#max_after", fmt.Sprintf("%d", statsAfter.Max)},
-		{"#cv_after", fmt.Sprintf("%.5f", statsAfter.CV)},
+		{"#hash", hashFuncName(opts)},
+		{"#mean_before", fmt.Sprintf("%.3f", res.statsBefore.Mean)},
+		{"#max_before", fmt.Sprintf("%d", res.statsBefore.Max)},
+		{"#cv_before", fmt.Sprintf("%.5f", res.statsBefore.CV)},
+		{"#mean_after", fmt.Sprintf("%.3f", res.statsAfter.Mean)},
+		{"#max_after", fmt.Sprintf("%d", res.statsAfter.Max)},
+		{"#cv_after", fmt.Sprintf("%.5f", res.statsAfter.CV)},
+	}...)
+	summaryRows = append(summaryRows, fairnessRows(res.statsBefore.Float(), "_before")...)
+	summaryRows = append(summaryRows, fairnessRows(res.statsAfter.Float(), "_after")...)
+	summaryRows = append(summaryRows,
+		[]string{"#kl_target_before", fmt.Sprintf("%.6f", res.klTargetBefore)},
+		[]string{"#kl_target_after", fmt.Sprintf("%.6f", res.klTargetAfter)},
+	)
+	if res.weighted {
+		summaryRows = append(summaryRows,
+			[]string{"#moved_weight", fmt.Sprintf("%.0f", res.movedWeight)},
+			[]string{"#moved_weight_ratio", fmt.Sprintf("%.6f", res.movedWeightRatio())},
+		)
+		summaryRows = append(summaryRows, weightRows(res.weightStatsBefore, "_before_weight")...)
+		summaryRows = append(summaryRows, weightRows(res.weightStatsAfter, "_after_weight")...)
+	}
+	if churnOp == "remove" {
+		summaryRows = append(summaryRows, []string{"#removed_nodes", strings.Join(res.targets, ";")})
 	}
+	if churnOp == "drain" {
+		summaryRows = append(summaryRows,
+			[]string{"#drain_node", strings.Join(res.targets, ";")},
+			[]string{"#rerouted", fmt.Sprintf("%d", res.dc.rerouted)},
+			[]string{"#moved_other", fmt.Sprintf("%d", res.dc.movedOtherDrain)},
+			[]string{"#moved_remove", fmt.Sprintf("%d", res.dc.movedRemove)},
+			[]string{"#moved_remove_ratio", fmt.Sprintf("%.6f", float64(res.dc.movedRemove)/float64(total))},
+			[]string{"#moved_other_remove", fmt.Sprintf("%d", res.dc.movedOtherRemove)},
+		)
+	}
+	if churnOp == "flap" {
+		summaryRows = append(summaryRows,
+			[]string{"#flap_node", strings.Join(res.targets, ";")},
+			[]string{"#moved_during", fmt.Sprintf("%d", res.fc.movedDuring)},
+			[]string{"#moved_after", fmt.Sprintf("%d", res.fc.movedAfter)},
+			[]string{"#moved_during_rebuild", fmt.Sprintf("%d", res.fc.movedDuringRebuild)},
+			[]string{"#moved_after_rebuild", fmt.Sprintf("%d", res.fc.movedAfterRebuild)},
+		)
+	}
+	if cp.zones > 0 {
+		summaryRows = append(summaryRows,
+			[]string{"#zones", fmt.Sprintf("%d", cp.zones)},
+			[]string{"#spread", domainName(opts.ReplicaSpread)},
+		)
+		if churnOp == "zone-fail" {
+			summaryRows = append(summaryRows, []string{"#fail_zone", cp.failZone})
+		}
+	}
+	if res.haveAvail {
+		summaryRows = append(summaryRows,
+			[]string{"#replicas", fmt.Sprintf("%d", cp.replicas)},
+			[]string{"#replica_available", fmt.Sprintf("%d", res.avail)},
+			[]string{"#replica_available_ratio", fmt.Sprintf("%.6f", float64(res.avail)/float64(total))},
+			[]string{"#replica_lost", fmt.Sprintf("%d", total-res.avail)},
+		)
+	}
+	summaryRows = append(summaryRows, trialRows...)
 
 	for _, row := range summaryRows {
 		if err := w.Write(row); err != nil {
@@ -337,22 +1170,411 @@ func runChurn(
 	}
 
 	log.Printf("mode=churn algo=%s churn_op=%s nodes_before=%d nodes_after=%d keys=%d moved=%d moved_ratio=%.4f",
-		algoName, churnOp, len(nodesBefore), len(nodesAfter), total, moved, movedRatio)
+		algoName, churnOp, len(nodesBefore), len(res.nodesAfter), total, res.moved, movedRatio)
+	if res.weighted {
+		log.Printf("weight moved_ratio=%.4f cv_before=%.4f cv_after=%.4f max_avg_after=%.4f",
+			res.movedWeightRatio(), res.weightStatsBefore.CV, res.weightStatsAfter.CV, res.weightStatsAfter.MaxAvg)
+	}
+	if churnOp == "drain" {
+		log.Printf("drain_node=%s rerouted=%d moved_other=%d | remove: moved=%d moved_other=%d",
+			strings.Join(res.targets, ";"), res.dc.rerouted, res.dc.movedOtherDrain, res.dc.movedRemove, res.dc.movedOtherRemove)
+	}
+	if churnOp == "flap" {
+		log.Printf("flap_node=%s overlay: during=%d after=%d | rebuild: during=%d after=%d",
+			strings.Join(res.targets, ";"), res.fc.movedDuring, res.fc.movedAfter, res.fc.movedDuringRebuild, res.fc.movedAfterRebuild)
+	}
+	if res.haveAvail {
+		log.Printf("replicas=%d spread=%s replica_available_ratio=%.4f",
+			cp.replicas, domainName(opts.ReplicaSpread), float64(res.avail)/float64(total))
+	}
+	tr.log()
 
 	return nil
 }
 
-func createCSVWriter(outPath string) (*os.File, *csv.Writer, error) {
-	var out *os.File
-	if outPath == "" {
-		out = os.Stdout
-	} else {
-		f, err := os.Create(outPath)
+// simulateChurnEach runs the churn in cp once per node of nodesBefore,
+// with that node as the only target.
+func simulateChurnEach(
+	algoEnum rc.Algo,
+	nodesBefore []string,
+	keys [][]byte,
+	weights []float64,
+	opts rc.Options,
+	cp churnParams,
+) ([]churnResult, error) {
+	results := make([]churnResult, len(nodesBefore))
+	for i, n := range nodesBefore {
+		c := cp
+		c.targets = []string{n}
+		res, err := simulateChurn(algoEnum, nodesBefore, keys, weights, opts, c)
 		if err != nil {
-			return nil, nil, fmt.Errorf("create output file: %w", err)
+			return nil, fmt.Errorf("%s %s: %w", cp.op, n, err)
 		}
-		out = f
+		results[i] = res
+	}
+	return results, nil
+}
+
+// runChurnEach repeats cp.op once for every node of nodesBefore, so the
+// moved ratio is not biased by which node happens to be chosen (removing
+// the last node is Jump's best case). It writes one row per node and the
+// mean, spread and worst case as summary rows.
+func runChurnEach(
+	algoName string,
+	algoEnum rc.Algo,
+	nodesBefore []string,
+	keys [][]byte,
+	weights []float64,
+	opts rc.Options,
+	wl workloadSpec,
+	seed int64,
+	cp churnParams,
+	dest output,
+) (err error) {
+	results, err := simulateChurnEach(algoEnum, nodesBefore, keys, weights, opts, cp)
+	if err != nil {
+		return err
+	}
+	ratios := make([]float64, len(results))
+	worst, best := 0, 0
+	for i, res := range results {
+		ratios[i] = res.movedRatio()
+		if ratios[i] > ratios[worst] {
+			worst = i
+		}
+		if ratios[i] < ratios[best] {
+			best = i
+		}
+	}
+	est := metrics.EstimateMean(ratios)
+
+	out, w, err := createWriter(dest)
+	if err != nil {
+		return err
+	}
+	defer closeOutput(out, w, &err)
+
+	header := []string{"node_id", "moved", "moved_ratio", "max_after", "cv_after", "max_avg_after"}
+	if weights != nil {
+		header = append(header, "moved_weight_ratio", "cv_after_weight")
+	}
+	if err := w.Write(header); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	for i, n := range nodesBefore {
+		res := results[i]
+		row := []string{
+			n,
+			fmt.Sprintf("%d", res.moved),
+			fmt.Sprintf("%.6f", ratios[i]),
+			fmt.Sprintf("%d", res.statsAfter.Max),
+			fmt.Sprintf("%.5f", res.statsAfter.CV),
+			fmt.Sprintf("%.5f", res.statsAfter.MaxAvg),
+		}
+		if weights != nil {
+			row = append(row,
+				fmt.Sprintf("%.6f", res.movedWeightRatio()),
+				fmt.Sprintf("%.5f", res.weightStatsAfter.CV),
+			)
+		}
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+	}
+
+	summaryRows := [][]string{
+		{"#mode", "churn-each"},
+		{"#algo", algoName},
+		{"#churn_op", cp.op},
+		{"#nodes_before", fmt.Sprintf("%d", len(nodesBefore))},
+		{"#keys", fmt.Sprintf("%d", len(keys))},
+	}
+	summaryRows = append(summaryRows, wl.rows()...)
+	summaryRows = append(summaryRows, [][]string{
+		{"#seed", fmt.Sprintf("%d", seed)},
+		{"#hash", hashFuncName(opts)},
+		{"#moved_ratio_mean", fmt.Sprintf("%.6f", est.Mean)},
+		{"#moved_ratio_std", fmt.Sprintf("%.6f", est.Std)},
+		{"#moved_ratio_min", fmt.Sprintf("%.6f", ratios[best])},
+		{"#moved_ratio_max", fmt.Sprintf("%.6f", ratios[worst])},
+		{"#best_node", nodesBefore[best]},
+		{"#worst_node", nodesBefore[worst]},
+	}...)
+	for _, row := range summaryRows {
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("write summary row: %w", err)
+		}
+	}
+
+	log.Printf("mode=churn-each algo=%s churn_op=%s nodes=%d keys=%d moved_ratio_mean=%.4f min=%.4f (%s) max=%.4f (%s)",
+		algoName, cp.op, len(nodesBefore), len(keys), est.Mean,
+		ratios[best], nodesBefore[best], ratios[worst], nodesBefore[worst])
+	return nil
+}
+
+// drainComparison contrasts draining nodes with removing them outright.
+type drainComparison struct {
+	rerouted         int // keys that were on a target and now route elsewhere (drain)
+	movedOtherDrain  int // keys not on a target that moved when draining
+	movedRemove      int // keys that moved when the targets were removed
+	movedOtherRemove int // keys not on a target that moved when removing
+}
+
+// compareDrainToRemove routes keys through fresh mappers for the original
+// cluster, the cluster with targets drained, and the cluster with targets
+// removed. Fresh mappers keep CH-BL's per-Pick load accounting comparable.
+func compareDrainToRemove(
+	algoEnum rc.Algo,
+	opts rc.Options,
+	nodes []string,
+	targets []string,
+	keys [][]byte,
+) (drainComparison, error) {
+	var dc drainComparison
+
+	isTarget := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		isTarget[t] = true
+	}
+	remaining := without(nodes, targets)
+
+	base, err := router.New(algoEnum, opts, nodes)
+	if err != nil {
+		return dc, fmt.Errorf("construct mapper(base): %w", err)
+	}
+	drained, err := router.New(algoEnum, opts, nodes)
+	if err != nil {
+		return dc, fmt.Errorf("construct mapper(drain): %w", err)
+	}
+	drained.Drain(targets...)
+	removed, err := router.New(algoEnum, opts, remaining)
+	if err != nil {
+		return dc, fmt.Errorf("construct mapper(remove): %w", err)
+	}
+
+	for _, k := range keys {
+		nb := base.Pick(k)
+		nd := drained.Pick(k)
+		nr := removed.Pick(k)
+
+		if isTarget[nb] {
+			if !isTarget[nd] {
+				dc.rerouted++
+			}
+		} else if nd != nb {
+			dc.movedOtherDrain++
+		}
+
+		if nr != nb {
+			dc.movedRemove++
+			if !isTarget[nb] {
+				dc.movedOtherRemove++
+			}
+		}
+	}
+	return dc, nil
+}
+
+// flapComparison contrasts a transient failure handled by the health
+// overlay with one handled by removing and re-adding the node. Counts are
+// keys whose node differs from the original (pre-failure) assignment.
+type flapComparison struct {
+	movedDuring        int // overlay, node unhealthy
+	movedAfter         int // overlay, node healthy again
+	movedDuringRebuild int // node removed
+	movedAfterRebuild  int // node removed, then added back
+}
+
+// compareFlap routes keys through the original cluster, the health overlay
+// during and after the targets' failure, and a Remove/Add rebuild of the
+// same failure. Each phase uses fresh mappers so CH-BL load does not leak
+// between phases.
+func compareFlap(
+	algoEnum rc.Algo,
+	opts rc.Options,
+	nodes []string,
+	targets []string,
+	keys [][]byte,
+) (flapComparison, error) {
+	var fc flapComparison
+
+	newOverlay := func() (*health.Mapper, error) {
+		inner, err := router.New(algoEnum, opts, nodes)
+		if err != nil {
+			return nil, err
+		}
+		return health.New(inner)
+	}
+
+	base, err := router.New(algoEnum, opts, nodes)
+	if err != nil {
+		return fc, fmt.Errorf("construct mapper(base): %w", err)
+	}
+	during, err := newOverlay()
+	if err != nil {
+		return fc, fmt.Errorf("construct overlay(during): %w", err)
+	}
+	during.MarkUnhealthy(targets...)
+	after, err := newOverlay()
+	if err != nil {
+		return fc, fmt.Errorf("construct overlay(after): %w", err)
+	}
+	after.MarkUnhealthy(targets...)
+	after.MarkHealthy(targets...)
+
+	duringRebuild, err := router.New(algoEnum, opts, nodes)
+	if err != nil {
+		return fc, fmt.Errorf("construct mapper(rebuild): %w", err)
+	}
+	duringRebuild.Remove(targets...)
+	afterRebuild, err := router.New(algoEnum, opts, nodes)
+	if err != nil {
+		return fc, fmt.Errorf("construct mapper(rebuild): %w", err)
+	}
+	afterRebuild.Remove(targets...)
+	afterRebuild.Add(targets...)
+
+	for _, k := range keys {
+		nb := base.Pick(k)
+		if during.Pick(k) != nb {
+			fc.movedDuring++
+		}
+		if after.Pick(k) != nb {
+			fc.movedAfter++
+		}
+		if duringRebuild.Pick(k) != nb {
+			fc.movedDuringRebuild++
+		}
+		if afterRebuild.Pick(k) != nb {
+			fc.movedAfterRebuild++
+		}
+	}
+	return fc, nil
+}
+
+// fairnessRows returns summary rows for the distribution and fairness
+// statistics beyond mean/max/cv, with suffix appended to each key
+// (e.g. "#gini_before").
+func fairnessRows(st metrics.FloatStats, suffix string) [][]string {
+	return [][]string{
+		{"#min" + suffix, strconv.FormatFloat(st.Min, 'f', -1, 64)},
+		{"#median" + suffix, fmt.Sprintf("%.3f", st.Median)},
+		{"#p90" + suffix, fmt.Sprintf("%.3f", st.P90)},
+		{"#p99" + suffix, fmt.Sprintf("%.3f", st.P99)},
+		{"#max_avg" + suffix, fmt.Sprintf("%.5f", st.MaxAvg)},
+		{"#min_avg" + suffix, fmt.Sprintf("%.5f", st.MinAvg)},
+		{"#gini" + suffix, fmt.Sprintf("%.6f", st.Gini)},
+		{"#jain" + suffix, fmt.Sprintf("%.6f", st.Jain)},
+		{"#entropy" + suffix, fmt.Sprintf("%.6f", st.Entropy)},
+		{"#kl_uniform" + suffix, fmt.Sprintf("%.6f", st.KLUniform)},
+	}
+}
+
+// targetShares returns the target weight of each node in nodeList: 1 for
+// members not in excluded, 0 otherwise.
+func targetShares(nodeList, members, excluded []string) []float64 {
+	live := make(map[string]bool, len(members))
+	for _, n := range without(members, excluded) {
+		live[n] = true
+	}
+	out := make([]float64, len(nodeList))
+	for i, n := range nodeList {
+		if live[n] {
+			out[i] = 1
+		}
+	}
+	return out
+}
+
+// weightRows returns summary rows for per-node request weight: the total,
+// mean, max and cv, then the fairnessRows, all with suffix appended
+// (e.g. "#cv_weight").
+func weightRows(st metrics.FloatStats, suffix string) [][]string {
+	rows := [][]string{
+		{"#total" + suffix, fmt.Sprintf("%.3f", st.Sum)},
+		{"#mean" + suffix, fmt.Sprintf("%.3f", st.Mean)},
+		{"#max" + suffix, fmt.Sprintf("%.3f", st.Max)},
+		{"#cv" + suffix, fmt.Sprintf("%.5f", st.CV)},
+	}
+	return append(rows, fairnessRows(st, suffix)...)
+}
+
+// hashFuncName returns the hash function name recorded in CSV metadata.
+func hashFuncName(opts rc.Options) string {
+	if opts.HashFunc == "" {
+		return hash.NameXXH64
+	}
+	return opts.HashFunc
+}
+
+// domainName renders a spread level for logs and CSV metadata.
+func domainName(d rc.Domain) string {
+	if d == rc.DomainNone {
+		return "none"
+	}
+	return string(d)
+}
+
+// replicaAvailability counts keys whose pre-churn replica set still has at
+// least one member in alive. The second result is false when the mapper
+// does not support replica selection.
+func replicaAvailability(m rc.Mapper, keys [][]byte, alive []string, replicas int) (int, bool) {
+	rp, ok := m.(rc.ReplicaPicker)
+	if !ok {
+		return 0, false
+	}
+	aliveSet := make(map[string]struct{}, len(alive))
+	for _, n := range alive {
+		aliveSet[n] = struct{}{}
+	}
+
+	available := 0
+	for _, k := range keys {
+		for _, r := range rp.PickN(k, replicas) {
+			if _, ok := aliveSet[r]; ok {
+				available++
+				break
+			}
+		}
+	}
+	return available, true
+}
+
+// tablePositions maps each entry of a mapper's node table to its position
+// in list, or -1 if the node is not in list.
+func tablePositions(table, list []string) []int {
+	pos := make(map[string]int, len(list))
+	for i, n := range list {
+		pos[n] = i
+	}
+	out := make([]int, len(table))
+	for i, n := range table {
+		if p, ok := pos[n]; ok {
+			out[i] = p
+		} else {
+			out[i] = -1
+		}
+	}
+	return out
+}
+
+// pickIndex routes keys[i]. With weights, mappers that bound load (CH-BL)
+// count weights[i] instead of one key, also behind the health overlay;
+// other mappers ignore the weight.
+func pickIndex(m rc.Mapper, keys [][]byte, weights []float64, i int) int {
+	if weights != nil {
+		if wp, ok := m.(rc.WeightedPicker); ok {
+			return wp.PickIndexWeighted(hash.BytesKey(keys[i]), weights[i])
+		}
+	}
+	return m.PickIndex(keys[i])
+}
+
+// listPosition converts a PickIndex result into a position via the table
+// built by tablePositions. Unassigned keys (idx < 0) map to -1.
+func listPosition(positions []int, idx int) int {
+	if idx < 0 {
+		return -1
 	}
-	w := csv.NewWriter(out)
-	return out, w, nil
+	return positions[idx]
 }
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ------------------ Output formats ------------------
+
+// Output formats accepted by -format.
+const (
+	formatCSV    = "csv"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// schemaName and schemaVersion identify the JSON layout; bump the version
+// when a field changes meaning or is removed.
+const (
+	schemaName    = "chbl-sim"
+	schemaVersion = 1
+)
+
+// output is where and how a mode writes its results.
+type output struct {
+	path   string // file path, or "" for stdout
+	format string // csv | json | ndjson
+	mode   string // -mode, for JSON output of modes without a #mode row
+}
+
+// rowWriter receives the CSV layout every mode produces: a header, data
+// rows, then "#key,value" summary rows. Error reports a failure of an
+// earlier Write or Flush, as csv.Writer does.
+type rowWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// createWriter opens dest and returns a writer for its format. CSV is
+// written as it comes; JSON and NDJSON are encoded on Flush.
+func createWriter(dest output) (io.Closer, rowWriter, error) {
+	var out *os.File
+	if dest.path == "" {
+		out = os.Stdout
+	} else {
+		f, err := os.Create(dest.path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create output file: %w", err)
+		}
+		out = f
+	}
+	switch dest.format {
+	case formatJSON, formatNDJSON:
+		return out, &jsonWriter{out: out, ndjson: dest.format == formatNDJSON, mode: dest.mode}, nil
+	default:
+		return out, csv.NewWriter(out), nil
+	}
+}
+
+// closeOutput flushes w and closes out. Modes defer it with their named
+// error result, which gets the flush or close error if the run itself
+// succeeded.
+func closeOutput(out io.Closer, w rowWriter, err *error) {
+	w.Flush()
+	flushErr := w.Error()
+	if flushErr != nil {
+		flushErr = fmt.Errorf("write output: %w", flushErr)
+	}
+	if closeErr := out.Close(); flushErr == nil && closeErr != nil {
+		flushErr = fmt.Errorf("close output: %w", closeErr)
+	}
+	if *err == nil {
+		*err = flushErr
+	}
+}
+
+// configKeys are the summary rows that describe the run rather than
+// measure it; they go to "config" and everything else to "summary".
+var configKeys = map[string]bool{
+	"mode": true, "algo": true, "nodes": true, "nodes_before": true, "keys": true,
+	"zipf_s": true, "workload": true, "trace": true, "trace_format": true, "trace_weighted": true,
+	"table_size": true, "load_factor": true, "vnodes": true, "walk_threshold": true,
+	"seed": true, "hash": true, "trials": true,
+	"churn_op": true, "zones": true, "replicas": true, "spread": true, "fail_zone": true,
+	"removed_nodes": true, "drain_node": true, "flap_node": true,
+	"scenario": true, "timeline": true,
+	"arrivals": true, "arrival_rate": true, "trace_time_unit": true,
+	"service_rate": true, "concurrency": true, "service": true,
+	"cache_size": true, "cache_window": true,
+	"buckets": true, "samples": true,
+	"bench_time": true, "num_cpu": true, "go_version": true, "goos": true, "goarch": true,
+	"baseline": true, "tolerance_cv": true, "tolerance_max": true, "tolerance_moved": true,
+}
+
+// textColumns and textRows are the columns and summary rows holding names
+// rather than measurements (node IDs, algorithms, labels, paths); JSON keeps
+// them as strings even when they look like numbers, e.g. node "007".
+var (
+	textColumns = map[string]bool{
+		"node_id": true, "algo": true, "hash": true, "pattern": true, "churn_op": true,
+		"metric": true, "name": true, "op": true, "file": true, "mode": true, "status": true,
+	}
+	textRows = map[string]bool{
+		"mode": true, "algo": true, "hash": true, "churn_op": true, "spread": true,
+		"removed_nodes": true, "drain_node": true, "flap_node": true, "fail_zone": true,
+		"best_node": true, "worst_node": true,
+		"scenario": true, "timeline": true, "workload": true, "trace": true, "trace_format": true,
+		"arrivals": true, "service": true, "baseline": true,
+		"bench_time": true, "go_version": true, "goos": true, "goarch": true,
+	}
+)
+
+func isConfigKey(k string) bool {
+	return configKeys[k] || strings.HasPrefix(k, "workload_")
+}
+
+// jsonWriter buffers a mode's rows and encodes them as one JSON document
+// or as NDJSON records:
+//
+//	{"record":"config","schema":"chbl-sim","schema_version":1,"mode":...,"columns":[...],"config":{...}}
+//	{"record":"row","row":{...}}            one per data row
+//	{"record":"summary","summary":{...}}
+//
+// The JSON document holds the same fields with the rows as a "rows" array.
+// Fields are typed by name: textColumns and textRows stay strings, the
+// others become numbers or "true"/"false" booleans, and "" is null.
+type jsonWriter struct {
+	out    io.Writer
+	ndjson bool
+	mode   string // used if no "#mode" row is written
+
+	columns []string
+	rows    [][]string
+	meta    [][2]string // summary rows in order, without the '#'
+	err     error       // from the last Flush
+}
+
+func (j *jsonWriter) Write(record []string) error {
+	switch {
+	case len(record) > 0 && strings.HasPrefix(record[0], "#"):
+		var v string
+		if len(record) > 1 {
+			v = record[1]
+		}
+		j.meta = append(j.meta, [2]string{strings.TrimPrefix(record[0], "#"), v})
+	case j.columns == nil:
+		j.columns = append([]string(nil), record...)
+	default:
+		j.rows = append(j.rows, append([]string(nil), record...))
+	}
+	return nil
+}
+
+// Flush encodes everything written so far; like csv.Writer, it leaves
+// encoding errors for Error.
+func (j *jsonWriter) Flush() {
+	if err := j.encode(); err != nil {
+		j.err = fmt.Errorf("%s: %w", j.format(), err)
+	}
+}
+
+// Error returns the error of the last Flush, if any.
+func (j *jsonWriter) Error() error { return j.err }
+
+func (j *jsonWriter) format() string {
+	if j.ndjson {
+		return formatNDJSON
+	}
+	return formatJSON
+}
+
+func (j *jsonWriter) encode() error {
+	config, summary := orderedObject{}, orderedObject{}
+	mode := j.mode
+	for _, kv := range j.meta {
+		if kv[0] == "mode" {
+			mode = kv[1]
+		}
+		if isConfigKey(kv[0]) {
+			config = append(config, field{kv[0], jsonValue(kv[1], textRows[kv[0]])})
+		} else {
+			summary = append(summary, field{kv[0], jsonValue(kv[1], textRows[kv[0]])})
+		}
+	}
+	rows := make([]orderedObject, len(j.rows))
+	for i, r := range j.rows {
+		for c, name := range j.columns {
+			var v any
+			if c < len(r) {
+				v = jsonValue(r[c], textColumns[name])
+			}
+			rows[i] = append(rows[i], field{name, v})
+		}
+	}
+
+	enc := json.NewEncoder(j.out)
+	head := orderedObject{
+		{"schema", schemaName},
+		{"schema_version", schemaVersion},
+		{"mode", mode},
+		{"columns", j.columns},
+		{"config", config},
+	}
+	if !j.ndjson {
+		enc.SetIndent("", "  ")
+		return enc.Encode(append(head, field{"rows", rows}, field{"summary", summary}))
+	}
+	if err := enc.Encode(append(orderedObject{{"record", "config"}}, head...)); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := enc.Encode(orderedObject{{"record", "row"}, {"row", r}}); err != nil {
+			return err
+		}
+	}
+	return enc.Encode(orderedObject{{"record", "summary"}, {"summary", summary}})
+}
+
+// jsonValue types a CSV cell; text cells stay strings.
+func jsonValue(s string, text bool) any {
+	switch {
+	case s == "":
+		return nil
+	case text:
+		return s
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) && !strings.ContainsAny(s, "xX") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return s
+}
+
+// field is one member of an orderedObject.
+type field struct {
+	key   string
+	value any
+}
+
+// orderedObject is a JSON object that keeps its keys in insertion order,
+// so output follows the CSV layout.
+type orderedObject []field
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	b := []byte{'{'}
+	for i, f := range o {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		k, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(append(b, k...), ':'), v...)
+	}
+	return append(b, '}'), nil
+}
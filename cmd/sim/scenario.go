@@ -0,0 +1,625 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/metrics"
+	router "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router/health"
+	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/workload"
+)
+
+// scenario is a checked-in simulation: a cluster, a workload, algorithm
+// options and a timeline of events. Metrics are recorded after every step.
+//
+// The dist mode is a scenario with a single step; churn mode is a baseline
+// step followed by one add/remove/drain/fail step (see clusterState).
+type scenario struct {
+	Name     string           `json:"name"`
+	Seed     *int64           `json:"seed,omitempty"` // default: -seed
+	Algo     string           `json:"algo"`
+	Options  scenarioOptions  `json:"options"`
+	Cluster  scenarioCluster  `json:"cluster"`
+	Workload scenarioWorkload `json:"workload"`
+	Steps    []scenarioStep   `json:"steps"`
+
+	trace *workload.Trace // loaded from Workload.Trace
+	gen   *generatorSpec  // parsed from Workload.Generator
+}
+
+// scenarioOptions mirrors the router flags; zero values take the same
+// defaults as the command line.
+type scenarioOptions struct {
+	Hash          string  `json:"hash"`
+	TableSize     int     `json:"tableSize"`
+	LoadFactor    float64 `json:"loadFactor"`
+	Vnodes        int     `json:"vnodes"`
+	WalkThreshold int     `json:"walkThreshold"`
+	ReplicaSpread string  `json:"replicaSpread"` // zone | rack | host | none
+}
+
+// scenarioCluster lists the initial nodes, either explicitly or as Count
+// generated nodes node-0..node-(Count-1) spread round-robin over Zones.
+type scenarioCluster struct {
+	Nodes []scenarioNode `json:"nodes"`
+	Count int            `json:"count"`
+	Zones int            `json:"zones"`
+}
+
+// scenarioNode describes a node. In JSON it is either an object or just
+// the node ID as a string.
+type scenarioNode struct {
+	ID     string  `json:"id"`
+	Weight float64 `json:"weight"` // target share for kl_target (default 1)
+	Zone   string  `json:"zone"`
+	Rack   string  `json:"rack"`
+	Host   string  `json:"host"`
+}
+
+func (n *scenarioNode) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*n = scenarioNode{}
+		return json.Unmarshal(b, &n.ID)
+	}
+	type plain scenarioNode // drop the method to avoid recursion
+	return json.Unmarshal(b, (*plain)(n))
+}
+
+// scenarioWorkload generates Keys uniform or Zipf keys, or Keys requests
+// from Generator (a -workload value), or replays Trace (relative to the
+// scenario file), capped at Keys requests if Keys > 0.
+type scenarioWorkload struct {
+	Keys      int     `json:"keys"`
+	ZipfS     float64 `json:"zipfS"`
+	Generator string  `json:"generator,omitempty"`
+	Trace     string  `json:"trace,omitempty"`
+}
+
+// workload returns the scenario's workload as keys and zipfS or a trace.
+func (sc *scenario) workload() workloadSpec {
+	return workloadSpec{
+		keys:      sc.Workload.Keys,
+		zipfS:     sc.Workload.ZipfS,
+		gen:       sc.gen,
+		trace:     sc.trace,
+		tracePath: sc.Workload.Trace,
+	}
+}
+
+// scenarioStep is one event on the timeline. Op is one of:
+//
+//	""       no change (e.g. the baseline)
+//	add      add Nodes to the cluster
+//	remove   remove Nodes from the cluster
+//	drain    drain Nodes (they keep membership but get no new keys)
+//	fail     mark Nodes unhealthy through the health overlay
+//	recover  mark Nodes healthy again
+//	rate     change the workload to Keys requests
+type scenarioStep struct {
+	Name  string         `json:"name"`
+	Op    string         `json:"op"`
+	Nodes []scenarioNode `json:"nodes"`
+	Keys  int            `json:"keys"`
+}
+
+// loadScenario reads and validates a scenario file.
+func loadScenario(path string) (*scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var sc scenario
+	if err := dec.Decode(&sc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	if sc.Algo == "" {
+		return nil, fmt.Errorf("%s: algo is required", path)
+	}
+	if _, err := parseAlgo(sc.Algo); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if sc.Workload.Trace != "" {
+		tp := sc.Workload.Trace
+		if !filepath.IsAbs(tp) {
+			tp = filepath.Join(filepath.Dir(path), tp)
+		}
+		if sc.trace, err = workload.LoadTrace(tp); err != nil {
+			return nil, fmt.Errorf("%s: workload.trace: %w", path, err)
+		}
+	} else if sc.Workload.Keys <= 0 {
+		return nil, fmt.Errorf("%s: workload.keys must be > 0", path)
+	}
+	if sc.Workload.Generator != "" {
+		if sc.Workload.Trace != "" {
+			return nil, fmt.Errorf("%s: workload has both a trace and a generator", path)
+		}
+		if sc.gen, err = parseGenerator(sc.Workload.Generator); err != nil {
+			return nil, fmt.Errorf("%s: workload.generator: %w", path, err)
+		}
+	}
+	if len(sc.Cluster.Nodes) == 0 && sc.Cluster.Count <= 0 {
+		return nil, fmt.Errorf("%s: cluster needs nodes or count > 0", path)
+	}
+	if len(sc.Steps) == 0 {
+		sc.Steps = []scenarioStep{{Name: "baseline"}}
+	}
+	for i, st := range sc.Steps {
+		switch st.Op {
+		case "":
+		case "add", "remove", "drain", "fail", "recover":
+			if len(st.Nodes) == 0 {
+				return nil, fmt.Errorf("%s: step %d (%s) needs nodes", path, i, st.Op)
+			}
+		case "rate":
+			if st.Keys <= 0 {
+				return nil, fmt.Errorf("%s: step %d (rate) needs keys > 0", path, i)
+			}
+		default:
+			return nil, fmt.Errorf("%s: step %d: unknown op %q (expected add|remove|drain|fail|recover|rate)", path, i, st.Op)
+		}
+	}
+	return &sc, nil
+}
+
+// initialState returns the cluster before the first step.
+func (sc *scenario) initialState() (*scenarioState, error) {
+	initial := scenarioStep{Op: "add", Nodes: sc.Cluster.Nodes}
+	if len(initial.Nodes) == 0 {
+		ids := make([]string, sc.Cluster.Count)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("node-%d", i)
+		}
+		initial = clusterStep("add", ids, buildTopology(sc.Cluster.Count, sc.Cluster.Zones))
+	}
+	state := newScenarioState()
+	if err := state.apply(initial); err != nil {
+		return nil, fmt.Errorf("cluster: %w", err)
+	}
+	return state, nil
+}
+
+// clusterState returns the state of a scenario whose cluster is nodes,
+// labeled from topo. dist and churn mode build their mappers from it, so
+// a dist run is a one-step scenario and a churn run a two-step one.
+func clusterState(nodes []string, topo rc.Topology) (*scenarioState, error) {
+	state := newScenarioState()
+	if err := state.apply(clusterStep("add", nodes, topo)); err != nil {
+		return nil, fmt.Errorf("cluster: %w", err)
+	}
+	return state, nil
+}
+
+// clusterStep returns the step applying op to nodes, labeled from topo.
+func clusterStep(op string, nodes []string, topo rc.Topology) scenarioStep {
+	st := scenarioStep{Name: op, Op: op}
+	for _, id := range nodes {
+		l := topo[id]
+		st.Nodes = append(st.Nodes, scenarioNode{ID: id, Zone: l.Zone, Rack: l.Rack, Host: l.Host})
+	}
+	return st
+}
+
+// scenarioState is the cluster as of the current step.
+type scenarioState struct {
+	members []string // in join order
+	info    map[string]scenarioNode
+	drained map[string]bool
+	failed  map[string]bool
+}
+
+func newScenarioState() *scenarioState {
+	return &scenarioState{
+		info:    make(map[string]scenarioNode),
+		drained: make(map[string]bool),
+		failed:  make(map[string]bool),
+	}
+}
+
+func (s *scenarioState) isMember(id string) bool {
+	for _, m := range s.members {
+		if m == id {
+			return true
+		}
+	}
+	return false
+}
+
+// apply performs a membership or health event.
+func (s *scenarioState) apply(st scenarioStep) error {
+	for _, n := range st.Nodes {
+		switch st.Op {
+		case "add":
+			if s.isMember(n.ID) {
+				return fmt.Errorf("add %s: already a member", n.ID)
+			}
+			s.members = append(s.members, n.ID)
+			// re-adding by bare ID keeps the node's earlier labels
+			if _, known := s.info[n.ID]; !known || n != (scenarioNode{ID: n.ID}) {
+				s.info[n.ID] = n
+			}
+			delete(s.drained, n.ID)
+			delete(s.failed, n.ID)
+		case "remove":
+			if !s.isMember(n.ID) {
+				return fmt.Errorf("remove %s: not a member", n.ID)
+			}
+			out := s.members[:0:0]
+			for _, m := range s.members {
+				if m != n.ID {
+					out = append(out, m)
+				}
+			}
+			if len(out) == 0 {
+				return fmt.Errorf("remove %s: would leave no nodes", n.ID)
+			}
+			s.members = out
+			delete(s.drained, n.ID)
+			delete(s.failed, n.ID)
+		case "drain", "fail", "recover":
+			if !s.isMember(n.ID) {
+				return fmt.Errorf("%s %s: not a member", st.Op, n.ID)
+			}
+			switch st.Op {
+			case "drain":
+				s.drained[n.ID] = true
+			case "fail":
+				s.failed[n.ID] = true
+			case "recover":
+				delete(s.failed, n.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// topology returns zone/rack/host labels for every node seen so far.
+func (s *scenarioState) topology() rc.Topology {
+	topo := make(rc.Topology, len(s.info))
+	labeled := false
+	for id, n := range s.info {
+		topo[id] = rc.NodeLabels{Zone: n.Zone, Rack: n.Rack, Host: n.Host}
+		labeled = labeled || n.Zone != "" || n.Rack != "" || n.Host != ""
+	}
+	if !labeled {
+		return nil
+	}
+	return topo
+}
+
+// mapper builds a fresh mapper for the current state, so CH-BL load
+// accounting starts from zero at every step (as in churn mode).
+func (s *scenarioState) mapper(algo rc.Algo, opts rc.Options) (rc.Mapper, error) {
+	opts.Topology = s.topology()
+	if opts.Topology == nil {
+		opts.ReplicaSpread = rc.DomainNone // no labels to spread across
+	}
+	inner, err := router.New(algo, opts, s.members)
+	if err != nil {
+		return nil, err
+	}
+	var drained []string
+	for _, m := range s.members {
+		if s.drained[m] {
+			drained = append(drained, m)
+		}
+	}
+	if len(drained) > 0 {
+		inner.Drain(drained...)
+	}
+	if len(s.failed) == 0 {
+		return inner, nil
+	}
+	overlay, err := health.New(inner)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range s.members {
+		if s.failed[m] {
+			overlay.MarkUnhealthy(m)
+		}
+	}
+	return overlay, nil
+}
+
+// scenarioRow is the metrics recorded after one step.
+type scenarioRow struct {
+	step     int
+	name, op string
+	members  int
+	drained  int
+	failed   int
+	keys     int
+	compared int // requests whose key was also routed in the previous step
+	moved    int
+	stats    metrics.IntStats
+	klTarget float64
+	minMoved int // theoretical minimum of moved (see minMoved)
+	unrouted int // requests no node accepted (CH-BL at capacity)
+}
+
+var scenarioHeader = []string{
+	"step", "name", "op", "members", "drained", "failed", "keys", "moved", "moved_ratio",
+	"min_moved", "cum_moved", "cum_min_moved", "unrouted", "mean", "max", "cv", "p99", "max_avg", "min_avg", "gini", "jain", "kl_uniform", "kl_target",
+}
+
+// runScenario replays a scenario and writes one row per step.
+func runScenario(sc *scenario, defaults rc.Options, seed int64, dest output) error {
+	if sc.Seed != nil {
+		seed = *sc.Seed
+	}
+	algoEnum, _ := parseAlgo(sc.Algo)
+
+	opts := defaults
+	opts.HashSeed = uint64(seed)
+	if sc.Options.Hash != "" {
+		opts.HashFunc = sc.Options.Hash
+	}
+	if sc.Options.TableSize > 0 {
+		opts.TableSize = sc.Options.TableSize
+	}
+	if sc.Options.LoadFactor > 0 {
+		opts.LoadFactor = sc.Options.LoadFactor
+	}
+	if sc.Options.Vnodes > 0 {
+		opts.Vnodes = sc.Options.Vnodes
+	}
+	if sc.Options.WalkThreshold > 0 {
+		opts.WalkThreshold = sc.Options.WalkThreshold
+	}
+	if sc.Options.ReplicaSpread != "" {
+		d, err := parseDomain(sc.Options.ReplicaSpread)
+		if err != nil {
+			return err
+		}
+		opts.ReplicaSpread = d
+	}
+
+	state, err := sc.initialState()
+	if err != nil {
+		return err
+	}
+
+	wl := sc.workload()
+	wl.algo, wl.nodes, wl.opts = algoEnum, append([]string(nil), state.members...), opts
+	keys, weights, err := wl.requests(seed)
+	if err != nil {
+		return err
+	}
+
+	var rows []scenarioRow
+	var prevKeys [][]byte
+	var prevNodes []string // node per request in the previous step
+	var firstKeys [][]byte
+	var firstNodes []string
+	var prevCounts map[string]int
+	for i, st := range sc.Steps {
+		availBefore := state.available()
+		if st.Op == "rate" {
+			wl.keys = st.Keys
+			if keys, weights, err = wl.requests(seed); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+		} else if err := state.apply(st); err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+
+		m, err := state.mapper(algoEnum, sizedFor(opts, keys, weights))
+		if err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+
+		table := m.Nodes()
+		nodes := make([]string, len(keys))
+		counts := make(map[string]int, len(state.members))
+		row := scenarioRow{
+			step:    i,
+			name:    st.Name,
+			op:      st.Op,
+			members: len(state.members),
+			drained: len(state.drained),
+			failed:  len(state.failed),
+			keys:    len(keys),
+		}
+		for j := range keys {
+			if idx := pickIndex(m, keys, weights, j); idx >= 0 {
+				nodes[j] = table[idx]
+				counts[table[idx]]++
+			} else {
+				row.unrouted++
+			}
+		}
+		row.compared, row.moved = compareSteps(prevKeys, prevNodes, keys, nodes)
+		if prevKeys != nil && st.Op != "rate" {
+			row.minMoved = minMoved(state, availBefore, prevCounts, len(keys))
+		}
+
+		perNode := make([]int, len(state.members))
+		nodeWeights := make([]float64, len(state.members))
+		for j, id := range state.members {
+			perNode[j] = counts[id]
+			nodeWeights[j] = nodeWeight(state, id)
+		}
+		row.stats = metrics.ComputeIntStats(perNode)
+		row.klTarget = metrics.KLDivergence(perNode, nodeWeights)
+		rows = append(rows, row)
+
+		prevKeys, prevNodes, prevCounts = keys, nodes, counts
+		if firstKeys == nil {
+			firstKeys, firstNodes = keys, nodes
+		}
+	}
+	_, netMoved := compareSteps(firstKeys, firstNodes, prevKeys, prevNodes)
+
+	return writeScenario(sc, opts, seed, rows, netMoved, dest)
+}
+
+// available returns the members that can take new keys (not drained or
+// failed).
+func (s *scenarioState) available() map[string]bool {
+	out := make(map[string]bool, len(s.members))
+	for _, m := range s.members {
+		if !s.drained[m] && !s.failed[m] {
+			out[m] = true
+		}
+	}
+	return out
+}
+
+// minMoved is the theoretical minimum number of requests to move in a
+// step: every request on a node that became unavailable, and enough
+// requests to give newly available nodes their weighted share. A request
+// moved off a lost node can fill a new one, so the minimum is the larger
+// of the two. An algorithm that under-fills a new node can move fewer.
+func minMoved(s *scenarioState, before map[string]bool, prevCounts map[string]int, keys int) int {
+	after := s.available()
+	lost := 0
+	for id := range before {
+		if !after[id] {
+			lost += prevCounts[id]
+		}
+	}
+	var gained, total float64
+	for id := range after {
+		w := nodeWeight(s, id)
+		total += w
+		if !before[id] {
+			gained += w
+		}
+	}
+	fill := 0
+	if total > 0 {
+		fill = int(math.Round(float64(keys) * gained / total))
+	}
+	return max(lost, fill)
+}
+
+// nodeWeight is the target share of a node: its configured weight, or 0
+// while it is drained or failed (it should carry no new load).
+func nodeWeight(s *scenarioState, id string) float64 {
+	if s.drained[id] || s.failed[id] {
+		return 0
+	}
+	if w := s.info[id].Weight; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// compareSteps counts requests routed to a different node than in the
+// previous step. With an unchanged workload requests are compared by
+// position (as in churn mode); after a rate change, by key.
+func compareSteps(prevKeys [][]byte, prevNodes []string, keys [][]byte, nodes []string) (compared, moved int) {
+	if prevKeys == nil {
+		return 0, 0
+	}
+	if len(prevKeys) == len(keys) && &prevKeys[0] == &keys[0] {
+		for j := range nodes {
+			if nodes[j] != prevNodes[j] {
+				moved++
+			}
+		}
+		return len(nodes), moved
+	}
+	last := make(map[string]string, len(prevKeys))
+	for j, k := range prevKeys {
+		last[string(k)] = prevNodes[j]
+	}
+	for j, k := range keys {
+		if p, ok := last[string(k)]; ok {
+			compared++
+			if p != nodes[j] {
+				moved++
+			}
+		}
+	}
+	return compared, moved
+}
+
+func writeScenario(sc *scenario, opts rc.Options, seed int64, rows []scenarioRow, netMoved int, dest output) (err error) {
+	out, w, err := createWriter(dest)
+	if err != nil {
+		return err
+	}
+	defer closeOutput(out, w, &err)
+
+	if err := w.Write(scenarioHeader); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	var cumMoved, cumMin int
+	for _, r := range rows {
+		cumMoved += r.moved
+		cumMin += r.minMoved
+		movedRatio := 0.0
+		if r.compared > 0 {
+			movedRatio = float64(r.moved) / float64(r.compared)
+		}
+		if err := w.Write([]string{
+			strconv.Itoa(r.step),
+			r.name,
+			r.op,
+			strconv.Itoa(r.members),
+			strconv.Itoa(r.drained),
+			strconv.Itoa(r.failed),
+			strconv.Itoa(r.keys),
+			strconv.Itoa(r.moved),
+			fmt.Sprintf("%.6f", movedRatio),
+			strconv.Itoa(r.minMoved),
+			strconv.Itoa(cumMoved),
+			strconv.Itoa(cumMin),
+			strconv.Itoa(r.unrouted),
+			fmt.Sprintf("%.3f", r.stats.Mean),
+			strconv.Itoa(r.stats.Max),
+			fmt.Sprintf("%.5f", r.stats.CV),
+			fmt.Sprintf("%.3f", r.stats.P99),
+			fmt.Sprintf("%.5f", r.stats.MaxAvg),
+			fmt.Sprintf("%.5f", r.stats.MinAvg),
+			fmt.Sprintf("%.6f", r.stats.Gini),
+			fmt.Sprintf("%.6f", r.stats.Jain),
+			fmt.Sprintf("%.6f", r.stats.KLUniform),
+			fmt.Sprintf("%.6f", r.klTarget),
+		}); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+		log.Printf("scenario=%s step=%d op=%s members=%d keys=%d moved=%d min_moved=%d cv=%.4f max_avg=%.3f",
+			sc.Name, r.step, r.op, r.members, r.keys, r.moved, r.minMoved, r.stats.CV, r.stats.MaxAvg)
+	}
+	movedOverMin := 0.0
+	if cumMin > 0 {
+		movedOverMin = float64(cumMoved) / float64(cumMin)
+	}
+	log.Printf("scenario=%s total_moved=%d total_min_moved=%d moved_over_min=%.3f net_moved=%d",
+		sc.Name, cumMoved, cumMin, movedOverMin, netMoved)
+
+	summaryRows := [][]string{
+		{"#mode", "scenario"},
+		{"#scenario", sc.Name},
+		{"#algo", sc.Algo},
+	}
+	summaryRows = append(summaryRows, sc.workload().rows()...)
+	summaryRows = append(summaryRows, [][]string{
+		{"#seed", fmt.Sprintf("%d", seed)},
+		{"#hash", hashFuncName(opts)},
+		{"#steps", fmt.Sprintf("%d", len(rows))},
+		{"#total_moved", fmt.Sprintf("%d", cumMoved)},
+		{"#total_min_moved", fmt.Sprintf("%d", cumMin)},
+		{"#moved_over_min", fmt.Sprintf("%.6f", movedOverMin)},
+		{"#net_moved", fmt.Sprintf("%d", netMoved)},
+	}...)
+	for _, row := range summaryRows {
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("write summary row: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/metrics"
+	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+// sweepParams lists the values swept in sweep mode. Every algorithm is run
+// over the cross product of the parameters it uses; parameters it ignores
+// are not multiplied out.
+type sweepParams struct {
+	algos          []string
+	nodes          []int
+	keys           []int
+	zipfS          []float64
+	vnodes         []int
+	loadFactors    []float64
+	tableSizes     []int
+	walkThresholds []int
+
+	churn    churnParams  // churn.op == "" sweeps distribution metrics only
+	replay   workloadSpec // a trace or generator used instead of the keys and zipfS lists
+	zones    int
+	trials   int
+	parallel int
+}
+
+// sweepConfig is one point of the sweep.
+type sweepConfig struct {
+	algo  string
+	nodes int
+	keys  int
+	zipfS float64
+	opts  rc.Options
+
+	// which of opts' algorithm parameters this algo actually uses
+	usesVnodes, usesLoadFactor, usesTableSize, usesWalkThreshold bool
+}
+
+// sweepMetric is one output value of one trial of one configuration.
+type sweepMetric struct {
+	name  string
+	value float64
+}
+
+var sweepHeader = []string{
+	"algo", "nodes", "keys", "zipf_s", "vnodes", "load_factor", "table_size",
+	"walk_threshold", "hash", "churn_op", "trial", "seed", "metric", "value",
+}
+
+// expandSweep builds the configurations for p, using base for everything
+// that is not swept.
+func expandSweep(p sweepParams, base rc.Options) ([]sweepConfig, error) {
+	if p.replay.trace != nil {
+		keys, _, _ := p.replay.requests(0)
+		p.keys, p.zipfS = []int{len(keys)}, []float64{0}
+	}
+	if p.replay.gen != nil {
+		p.zipfS = []float64{0}
+	}
+	var out []sweepConfig
+	for _, algo := range p.algos {
+		algoEnum, err := parseAlgo(algo)
+		if err != nil {
+			return nil, err
+		}
+		proto := sweepConfig{
+			algo:              algo,
+			usesVnodes:        algoEnum == rc.AlgoCHBL || algoEnum == rc.AlgoRing,
+			usesLoadFactor:    algoEnum == rc.AlgoCHBL,
+			usesTableSize:     algoEnum == rc.AlgoMaglev,
+			usesWalkThreshold: algoEnum == rc.AlgoCHBL,
+		}
+		vnodes := onlyIf(proto.usesVnodes, p.vnodes)
+		loadFactors := onlyIf(proto.usesLoadFactor, p.loadFactors)
+		tableSizes := onlyIf(proto.usesTableSize, p.tableSizes)
+		walkThresholds := onlyIf(proto.usesWalkThreshold, p.walkThresholds)
+
+		for _, n := range p.nodes {
+			for _, k := range p.keys {
+				for _, z := range p.zipfS {
+					for _, v := range vnodes {
+						for _, lf := range loadFactors {
+							for _, ts := range tableSizes {
+								for _, wt := range walkThresholds {
+									c := proto
+									c.nodes, c.keys, c.zipfS = n, k, z
+									c.opts = base
+									c.opts.Vnodes = v
+									c.opts.LoadFactor = lf
+									c.opts.TableSize = ts
+									c.opts.WalkThreshold = wt
+									c.opts.ExpectedKeys = k
+									c.opts.Topology = buildTopology(n+1, p.zones)
+									out = append(out, c)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// onlyIf returns vals if the parameter is used, or just its first value
+// otherwise, so unused parameters do not multiply the sweep.
+func onlyIf[T any](used bool, vals []T) []T {
+	if used || len(vals) == 0 {
+		return vals
+	}
+	return vals[:1]
+}
+
+// runSweepConfig runs every trial of one configuration.
+func runSweepConfig(c sweepConfig, p sweepParams, seed int64) ([][]sweepMetric, error) {
+	algoEnum, err := parseAlgo(c.algo)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]string, c.nodes)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("node-%d", i)
+	}
+
+	out := make([][]sweepMetric, p.trials)
+	for t := 0; t < p.trials; t++ {
+		wl := workloadSpec{keys: c.keys, zipfS: c.zipfS, gen: p.replay.gen, algo: algoEnum, nodes: nodes, opts: c.opts}
+		if p.replay.trace != nil {
+			wl = p.replay
+		}
+		opts, keys, weights, err := trialInputs(c.opts, wl, seed, t)
+		if err != nil {
+			return nil, err
+		}
+
+		dist, err := simulateDistribution(algoEnum, nodes, keys, weights, opts)
+		if err != nil {
+			return nil, err
+		}
+		ms := loadMetrics(dist.stats.Float(), "")
+		if dist.weight != nil {
+			ms = append(ms, loadMetrics(dist.weightStats, "_weight")...)
+		}
+
+		if p.churn.op != "" {
+			cp := p.churn
+			cp.targetSeed = trialSeed(seed, t)
+			res, err := simulateChurn(algoEnum, nodes, keys, weights, opts, cp)
+			if err != nil {
+				return nil, err
+			}
+			ms = append(ms, sweepMetric{"moved_ratio", res.movedRatio()})
+			ms = append(ms, loadMetrics(res.statsAfter.Float(), "_after")...)
+			if res.weighted {
+				ms = append(ms, sweepMetric{"moved_weight_ratio", res.movedWeightRatio()})
+				ms = append(ms, loadMetrics(res.weightStatsAfter, "_after_weight")...)
+			}
+		}
+		out[t] = ms
+	}
+	return out, nil
+}
+
+// loadMetrics flattens the load statistics written by the sweep.
+func loadMetrics(st metrics.FloatStats, suffix string) []sweepMetric {
+	return []sweepMetric{
+		{"mean" + suffix, st.Mean},
+		{"max" + suffix, st.Max},
+		{"std" + suffix, st.Std},
+		{"cv" + suffix, st.CV},
+		{"p99" + suffix, st.P99},
+		{"max_avg" + suffix, st.MaxAvg},
+		{"min_avg" + suffix, st.MinAvg},
+		{"gini" + suffix, st.Gini},
+		{"jain" + suffix, st.Jain},
+		{"entropy" + suffix, st.Entropy},
+		{"kl_uniform" + suffix, st.KLUniform},
+	}
+}
+
+// runSweep runs every configuration on p.parallel workers and writes one
+// long-format row per configuration × trial × metric, in configuration
+// order regardless of which worker finished first.
+func runSweep(p sweepParams, base rc.Options, seed int64, dest output) (err error) {
+	configs, err := expandSweep(p, base)
+	if err != nil {
+		return err
+	}
+
+	results := make([][][]sweepMetric, len(configs))
+	errs := make([]error, len(configs))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < p.parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = runSweepConfig(configs[i], p, seed)
+			}
+		}()
+	}
+	for i := range configs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("sweep config %d (%s nodes=%d): %w", i, configs[i].algo, configs[i].nodes, err)
+		}
+	}
+
+	out, w, err := createWriter(dest)
+	if err != nil {
+		return err
+	}
+	defer closeOutput(out, w, &err)
+
+	if err := w.Write(sweepHeader); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	rows := 0
+	for i, c := range configs {
+		fixed := []string{
+			c.algo,
+			strconv.Itoa(c.nodes),
+			strconv.Itoa(c.keys),
+			zipfColumn(p.replay, c.zipfS),
+			usedInt(c.usesVnodes, c.opts.Vnodes),
+			usedFloat(c.usesLoadFactor, c.opts.LoadFactor),
+			usedInt(c.usesTableSize, c.opts.TableSize),
+			usedInt(c.usesWalkThreshold, c.opts.WalkThreshold),
+			hashFuncName(c.opts),
+			p.churn.op,
+		}
+		for t, ms := range results[i] {
+			for _, m := range ms {
+				row := append(append([]string(nil), fixed...),
+					strconv.Itoa(t),
+					strconv.FormatInt(trialSeed(seed, t), 10),
+					m.name,
+					strconv.FormatFloat(m.value, 'f', 6, 64),
+				)
+				if err := w.Write(row); err != nil {
+					return fmt.Errorf("write row: %w", err)
+				}
+				rows++
+			}
+		}
+	}
+
+	if p.replay.trace != nil || p.replay.gen != nil {
+		log.Printf("sweep uses %s", p.replay)
+	}
+	log.Printf("mode=sweep configs=%d trials=%d rows=%d parallel=%d", len(configs), p.trials, rows, p.parallel)
+	return nil
+}
+
+// zipfColumn formats the zipf_s column, which is empty for a replayed trace
+// or a generator.
+func zipfColumn(replay workloadSpec, zipfS float64) string {
+	if replay.trace != nil || replay.gen != nil {
+		return ""
+	}
+	return fmt.Sprintf("%.3f", zipfS)
+}
+
+// usedInt formats a parameter value, or "" if the algorithm ignores it.
+func usedInt(used bool, v int) string {
+	if !used {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
+
+func usedFloat(used bool, v float64) string {
+	if !used {
+		return ""
+	}
+	return fmt.Sprintf("%.3f", v)
+}
+
+// parseIntRange parses "a,b,c" or an inclusive "start:end:step" range
+// (step defaults to 1). Parts may mix both forms: "8,16:64:16".
+func parseIntRange(s string) ([]int, error) {
+	var out []int
+	for _, part := range splitList(s) {
+		if !strings.Contains(part, ":") {
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("bad value %q: %w", part, err)
+			}
+			out = append(out, v)
+			continue
+		}
+		f := strings.Split(part, ":")
+		if len(f) < 2 || len(f) > 3 {
+			return nil, fmt.Errorf("bad range %q (expected start:end[:step])", part)
+		}
+		nums := []int{0, 0, 1}
+		for i, x := range f {
+			v, err := strconv.Atoi(strings.TrimSpace(x))
+			if err != nil {
+				return nil, fmt.Errorf("bad range %q: %w", part, err)
+			}
+			nums[i] = v
+		}
+		if nums[2] <= 0 || nums[1] < nums[0] {
+			return nil, fmt.Errorf("bad range %q (need start <= end and step > 0)", part)
+		}
+		for v := nums[0]; v <= nums[1]; v += nums[2] {
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty list %q", s)
+	}
+	return out, nil
+}
+
+// parseFloatRange is parseIntRange for floats. Range end points are
+// included up to a small tolerance, so "1.0:1.5:0.1" yields six values.
+func parseFloatRange(s string) ([]float64, error) {
+	var out []float64
+	for _, part := range splitList(s) {
+		if !strings.Contains(part, ":") {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad value %q: %w", part, err)
+			}
+			out = append(out, v)
+			continue
+		}
+		f := strings.Split(part, ":")
+		if len(f) != 3 {
+			return nil, fmt.Errorf("bad range %q (expected start:end:step)", part)
+		}
+		var nums [3]float64
+		for i, x := range f {
+			v, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad range %q: %w", part, err)
+			}
+			nums[i] = v
+		}
+		if nums[2] <= 0 || nums[1] < nums[0] {
+			return nil, fmt.Errorf("bad range %q (need start <= end and step > 0)", part)
+		}
+		// step by index to avoid accumulating rounding error
+		for i := 0; ; i++ {
+			v := nums[0] + float64(i)*nums[2]
+			if v > nums[1]+nums[2]*1e-9 {
+				break
+			}
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty list %q", s)
+	}
+	return out, nil
+}
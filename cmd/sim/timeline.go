@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// timelineParams configures the generated churn timelines.
+type timelineParams struct {
+	kind      string // rolling-restart | scale-out | random-failures
+	scaleTo   int    // scale-out: final node count
+	scaleStep int    // scale-out: nodes added per step
+	failures  int    // random-failures: nodes removed, one per step
+}
+
+// timelineScenario builds a scenario for a multi-step churn timeline over
+// node-0..node-(nodes-1). Router options and the seed come from the
+// command line.
+func timelineScenario(algo string, nodes int, wl workloadSpec, zones int, tp timelineParams, seed int64) (*scenario, error) {
+	sc := &scenario{
+		Name:     tp.kind,
+		Algo:     algo,
+		Cluster:  scenarioCluster{Count: nodes, Zones: zones},
+		Workload: scenarioWorkload{Keys: wl.keys, ZipfS: wl.zipfS, Trace: wl.tracePath},
+		Steps:    []scenarioStep{{Name: "baseline"}},
+		trace:    wl.trace,
+		gen:      wl.gen,
+	}
+
+	switch tp.kind {
+	case "rolling-restart":
+		// each node leaves the cluster and rejoins before the next one
+		for i := 0; i < nodes; i++ {
+			id := fmt.Sprintf("node-%d", i)
+			sc.Steps = append(sc.Steps,
+				scenarioStep{Name: id + " down", Op: "remove", Nodes: []scenarioNode{{ID: id}}},
+				scenarioStep{Name: id + " up", Op: "add", Nodes: []scenarioNode{{ID: id}}},
+			)
+		}
+	case "scale-out":
+		if tp.scaleTo <= nodes {
+			return nil, fmt.Errorf("scale-out: -scale-to (%d) must exceed -nodes (%d)", tp.scaleTo, nodes)
+		}
+		for n := nodes; n < tp.scaleTo; {
+			end := min(n+tp.scaleStep, tp.scaleTo)
+			var added []scenarioNode
+			for ; n < end; n++ {
+				added = append(added, labeledNode(n, zones))
+			}
+			sc.Steps = append(sc.Steps, scenarioStep{
+				Name:  fmt.Sprintf("scale to %d", end),
+				Op:    "add",
+				Nodes: added,
+			})
+		}
+	case "random-failures":
+		if tp.failures >= nodes {
+			return nil, fmt.Errorf("random-failures: -failures (%d) must be below -nodes (%d)", tp.failures, nodes)
+		}
+		rng := rand.New(rand.NewSource(seed))
+		alive := make([]string, nodes)
+		for i := range alive {
+			alive[i] = fmt.Sprintf("node-%d", i)
+		}
+		for f := 0; f < tp.failures; f++ {
+			i := rng.Intn(len(alive))
+			id := alive[i]
+			alive = append(alive[:i], alive[i+1:]...)
+			sc.Steps = append(sc.Steps, scenarioStep{
+				Name:  id + " fails",
+				Op:    "remove",
+				Nodes: []scenarioNode{{ID: id}},
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown timeline %q (expected rolling-restart|scale-out|random-failures)", tp.kind)
+	}
+	return sc, nil
+}
+
+// labeledNode returns node-i with the zone buildTopology would give it.
+func labeledNode(i, zones int) scenarioNode {
+	n := scenarioNode{ID: fmt.Sprintf("node-%d", i)}
+	if zones > 0 {
+		n.Zone = fmt.Sprintf("zone-%d", i%zones)
+		n.Rack = n.ID
+		n.Host = n.ID
+	}
+	return n
+}
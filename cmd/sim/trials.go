@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/metrics"
+	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+// trialMetric is one quantity measured in every trial.
+type trialMetric struct {
+	name   string // summary row prefix, e.g. "cv"
+	values []float64
+}
+
+// trialSummary aggregates metrics over repeated runs with derived seeds.
+// The zero value (a single-trial run) writes and logs nothing.
+type trialSummary struct {
+	trials  int
+	metrics []trialMetric
+}
+
+// rows returns "#trials" followed by mean, stddev and 95% confidence
+// interval rows for every metric.
+func (ts trialSummary) rows() [][]string {
+	if ts.trials == 0 {
+		return nil
+	}
+	rows := [][]string{{"#trials", fmt.Sprintf("%d", ts.trials)}}
+	for _, m := range ts.metrics {
+		e := metrics.EstimateMean(m.values)
+		rows = append(rows,
+			[]string{"#" + m.name + "_mean", fmt.Sprintf("%.6f", e.Mean)},
+			[]string{"#" + m.name + "_std", fmt.Sprintf("%.6f", e.Std)},
+			[]string{"#" + m.name + "_ci95_lo", fmt.Sprintf("%.6f", e.CILow)},
+			[]string{"#" + m.name + "_ci95_hi", fmt.Sprintf("%.6f", e.CIHigh)},
+		)
+	}
+	return rows
+}
+
+func (ts trialSummary) log() {
+	for _, m := range ts.metrics {
+		e := metrics.EstimateMean(m.values)
+		log.Printf("trials=%d %s mean=%.5f std=%.5f ci95=[%.5f, %.5f]",
+			ts.trials, m.name, e.Mean, e.Std, e.CILow, e.CIHigh)
+	}
+}
+
+// trialSeed derives the seed for trial i. Trial 0 keeps the base seed, so
+// a multi-trial run always contains the single-trial result.
+func trialSeed(base int64, i int) int64 {
+	if i == 0 {
+		return base
+	}
+	// splitmix64 step keeps neighbouring base seeds' trials unrelated
+	return int64(hash.Mix64(uint64(base) + uint64(i)*0x9e3779b97f4a7c15))
+}
+
+// trialInputs returns the router options and keys for trial i: both the
+// hash seed and the workload seed are derived from the base seed. A
+// replayed trace is the same in every trial.
+func trialInputs(opts rc.Options, wl workloadSpec, seed int64, i int) (rc.Options, [][]byte, []float64, error) {
+	s := trialSeed(seed, i)
+	opts.HashSeed = uint64(s)
+	keys, weights, err := wl.requests(s)
+	return sizedFor(opts, keys, weights), keys, weights, err
+}
+
+// distTrials repeats a distribution run trials times; first is the result
+// of trial 0.
+func distTrials(
+	algoEnum rc.Algo,
+	nodes []string,
+	opts rc.Options,
+	wl workloadSpec,
+	seed int64,
+	trials int,
+	first distResult,
+) (trialSummary, error) {
+	cv := []float64{first.stats.CV}
+	maxAvg := []float64{first.stats.MaxAvg}
+	cvWeight := []float64{first.weightStats.CV}
+	maxAvgWeight := []float64{first.weightStats.MaxAvg}
+	for i := 1; i < trials; i++ {
+		o, keys, weights, err := trialInputs(opts, wl, seed, i)
+		if err != nil {
+			return trialSummary{}, fmt.Errorf("trial %d: %w", i, err)
+		}
+		res, err := simulateDistribution(algoEnum, nodes, keys, weights, o)
+		if err != nil {
+			return trialSummary{}, fmt.Errorf("trial %d: %w", i, err)
+		}
+		cv = append(cv, res.stats.CV)
+		maxAvg = append(maxAvg, res.stats.MaxAvg)
+		cvWeight = append(cvWeight, res.weightStats.CV)
+		maxAvgWeight = append(maxAvgWeight, res.weightStats.MaxAvg)
+	}
+	ts := trialSummary{trials: trials, metrics: []trialMetric{
+		{"cv", cv},
+		{"max_avg", maxAvg},
+	}}
+	if first.weight != nil {
+		ts.metrics = append(ts.metrics,
+			trialMetric{"cv_weight", cvWeight},
+			trialMetric{"max_avg_weight", maxAvgWeight},
+		)
+	}
+	return ts, nil
+}
+
+// churnTrials repeats a churn run trials times; first is the result of
+// trial 0.
+func churnTrials(
+	algoEnum rc.Algo,
+	nodesBefore []string,
+	opts rc.Options,
+	wl workloadSpec,
+	seed int64,
+	cp churnParams,
+	trials int,
+	first churnResult,
+) (trialSummary, error) {
+	moved := []float64{first.movedRatio()}
+	cv := []float64{first.statsAfter.CV}
+	maxAvg := []float64{first.statsAfter.MaxAvg}
+	movedWeight := []float64{first.movedWeightRatio()}
+	cvWeight := []float64{first.weightStatsAfter.CV}
+	for i := 1; i < trials; i++ {
+		o, keys, weights, err := trialInputs(opts, wl, seed, i)
+		if err != nil {
+			return trialSummary{}, fmt.Errorf("trial %d: %w", i, err)
+		}
+		c := cp
+		c.targetSeed = trialSeed(seed, i)
+		res, err := simulateChurn(algoEnum, nodesBefore, keys, weights, o, c)
+		if err != nil {
+			return trialSummary{}, fmt.Errorf("trial %d: %w", i, err)
+		}
+		moved = append(moved, res.movedRatio())
+		cv = append(cv, res.statsAfter.CV)
+		maxAvg = append(maxAvg, res.statsAfter.MaxAvg)
+		movedWeight = append(movedWeight, res.movedWeightRatio())
+		cvWeight = append(cvWeight, res.weightStatsAfter.CV)
+	}
+	ts := trialSummary{trials: trials, metrics: []trialMetric{
+		{"moved_ratio", moved},
+		{"cv_after", cv},
+		{"max_avg_after", maxAvg},
+	}}
+	if first.weighted {
+		ts.metrics = append(ts.metrics,
+			trialMetric{"moved_weight_ratio", movedWeight},
+			trialMetric{"cv_after_weight", cvWeight},
+		)
+	}
+	return ts, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	router "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router"
+	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/workload"
+)
+
+// workloadSpec describes the requests routed by a run: generated uniform or
+// Zipf keys, a synthetic generator, or a trace replayed from a file.
+type workloadSpec struct {
+	keys  int     // keys to generate; with a trace, replay at most this many (0 = all)
+	zipfS float64 // Zipf skew of generated keys (0 = uniform)
+
+	gen *generatorSpec // -workload generator instead of uniform/Zipf keys
+
+	trace     *workload.Trace
+	tracePath string
+
+	// cluster the adversarial generator aims at; the hash seed is the
+	// requests seed, as in every run
+	algo  rc.Algo
+	nodes []string
+	opts  rc.Options
+}
+
+// requests returns the keys routed with seed, and their weights or nil if
+// the requests are unweighted. Traces replay the same requests for every
+// seed.
+func (w workloadSpec) requests(seed int64) ([][]byte, []float64, error) {
+	if w.trace != nil {
+		n := w.trace.Len()
+		if w.keys > 0 && w.keys < n {
+			n = w.keys
+		}
+		var weights []float64
+		if w.trace.Weights != nil {
+			weights = w.trace.Weights[:n]
+		}
+		return w.trace.Keys[:n], weights, nil
+	}
+	if w.gen == nil {
+		keys, err := generateKeys(w.keys, w.zipfS, seed)
+		return keys, nil, err
+	}
+	g, err := w.generator(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := g.Generate(w.keys, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("workload %s: %w", w.gen.name, err)
+	}
+	return t.Keys, t.Weights, nil
+}
+
+// generator builds the workload.Generator for w.gen.
+func (w workloadSpec) generator(seed int64) (workload.Generator, error) {
+	p := w.gen.param
+	keyspace := int(p("keyspace"))
+	if keyspace == 0 {
+		keyspace = w.keys
+	}
+	switch w.gen.name {
+	case "hotspot":
+		return workload.HotKeys{
+			Keyspace: keyspace, S: p("s"), Hot: int(p("hot")),
+			Share: p("share"), Start: p("start"), End: p("end"),
+		}, nil
+	case "shifting-zipf":
+		return workload.ShiftingZipf{Keyspace: keyspace, S: p("s"), Epochs: int(p("epochs"))}, nil
+	case "pareto":
+		return workload.ParetoSizes{Keyspace: keyspace, S: p("s"), Alpha: p("alpha"), Min: p("min")}, nil
+	case "scan":
+		return workload.Scan{Keyspace: keyspace, Start: int(p("start")), Stride: int(p("stride"))}, nil
+	case "adversarial":
+		target := int(p("target"))
+		if target < 0 || target >= len(w.nodes) {
+			return nil, fmt.Errorf("workload adversarial: target %d is not a node index (0..%d)", target, len(w.nodes)-1)
+		}
+		// The attacker knows the hash and the membership but not the
+		// current loads, so it aims at each key's home node: give CH-BL
+		// enough capacity that the bound never applies.
+		o := w.opts
+		o.HashSeed = uint64(seed)
+		o.ExpectedKeys, o.ExpectedWeight = 1<<40, 0
+		m, err := router.New(w.algo, o, w.nodes)
+		if err != nil {
+			return nil, fmt.Errorf("workload adversarial: %w", err)
+		}
+		victim := w.nodes[target]
+		return workload.Adversarial{
+			Keyspace: keyspace,
+			Share:    p("share"),
+			Collides: func(k []byte) bool { return m.Pick(k) == victim },
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown workload %q", w.gen.name)
+}
+
+// sizedFor returns opts with CH-BL's capacity sized for the requests: the
+// key count, and the total weight if the requests are weighted.
+func sizedFor(opts rc.Options, keys [][]byte, weights []float64) rc.Options {
+	opts.ExpectedKeys = len(keys)
+	opts.ExpectedWeight = 0
+	for _, w := range weights {
+		opts.ExpectedWeight += w
+	}
+	return opts
+}
+
+// rows returns the summary rows describing the workload.
+func (w workloadSpec) rows() [][]string {
+	switch {
+	case w.trace != nil:
+		return [][]string{
+			{"#trace", w.tracePath},
+			{"#trace_format", w.trace.Format},
+			{"#trace_weighted", fmt.Sprintf("%t", w.trace.Weights != nil)},
+		}
+	case w.gen != nil:
+		rows := [][]string{{"#workload", w.gen.name}}
+		for _, p := range w.gen.params {
+			rows = append(rows, []string{"#workload_" + p.name, strconv.FormatFloat(p.value, 'g', -1, 64)})
+		}
+		return rows
+	default:
+		return [][]string{{"#zipf_s", fmt.Sprintf("%.3f", w.zipfS)}}
+	}
+}
+
+func (w workloadSpec) String() string {
+	switch {
+	case w.trace != nil:
+		return "trace=" + w.tracePath
+	case w.gen != nil:
+		return "workload=" + w.gen.String()
+	default:
+		return fmt.Sprintf("zipf_s=%.2f", w.zipfS)
+	}
+}
+
+// genParam is one numeric generator parameter.
+type genParam struct {
+	name  string
+	value float64
+}
+
+// generatorParams lists every -workload generator with its parameters and
+// their defaults. A keyspace of 0 means one key per request (-keys).
+var generatorParams = map[string][]genParam{
+	"hotspot":       {{"keyspace", 0}, {"s", 0}, {"hot", 10}, {"share", 0.5}, {"start", 0.25}, {"end", 0.75}},
+	"shifting-zipf": {{"keyspace", 0}, {"s", 1.1}, {"epochs", 4}},
+	"pareto":        {{"keyspace", 0}, {"s", 0}, {"alpha", 1.5}, {"min", 1}},
+	"scan":          {{"keyspace", 0}, {"start", 0}, {"stride", 1}},
+	"adversarial":   {{"keyspace", 0}, {"share", 1}, {"target", 0}},
+}
+
+func generatorNames() []string {
+	var names []string
+	for n := range generatorParams {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generatorSpec is a parsed -workload value such as
+// "hotspot:hot=5,share=0.9", with defaults filled in.
+type generatorSpec struct {
+	name   string
+	params []genParam
+}
+
+// parseGenerator parses "name" or "name:param=value,...".
+func parseGenerator(s string) (*generatorSpec, error) {
+	name, args, _ := strings.Cut(strings.TrimSpace(s), ":")
+	defaults, ok := generatorParams[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown workload %q (expected %s)", name, strings.Join(generatorNames(), "|"))
+	}
+	g := &generatorSpec{name: name, params: append([]genParam(nil), defaults...)}
+	for _, kv := range splitList(args) {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("workload %s: bad parameter %q (expected name=value)", name, kv)
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("workload %s: parameter %s: %w", name, k, err)
+		}
+		i := g.index(strings.TrimSpace(k))
+		if i < 0 {
+			return nil, fmt.Errorf("workload %s: unknown parameter %q", name, k)
+		}
+		g.params[i].value = f
+	}
+	return g, nil
+}
+
+func (g *generatorSpec) index(name string) int {
+	for i, p := range g.params {
+		if p.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// param returns the value of a parameter listed in generatorParams.
+func (g *generatorSpec) param(name string) float64 {
+	return g.params[g.index(name)].value
+}
+
+func (g *generatorSpec) String() string {
+	var parts []string
+	for _, p := range g.params {
+		parts = append(parts, p.name+"="+strconv.FormatFloat(p.value, 'g', -1, 64))
+	}
+	return g.name + ":" + strings.Join(parts, ",")
+}
@@ -12,6 +12,7 @@ func main() {
 
 	// Register routes
 	http.HandleFunc("/state", api.HandleState)
+	http.HandleFunc("/layout", api.HandleLayout)
 	http.HandleFunc("/add-node", api.HandleAddNode)
 	http.HandleFunc("/remove-node", api.HandleRemoveNode)
 	http.HandleFunc("/regenerate-keys", api.HandleRegenerateKeys)
@@ -35,6 +36,7 @@ func main() {
 	log.Println("Visualizer server starting on http://localhost:8080")
 	log.Println("Endpoints:")
 	log.Println("  GET  /state")
+	log.Println("  GET  /layout")
 	log.Println("  POST /add-node")
 	log.Println("  POST /remove-node")
 	log.Println("  POST /regenerate-keys")
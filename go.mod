@@ -2,4 +2,10 @@ module github.com/bhusalashish/consistent-hashing-bounded-loads.git
 
 go 1.25.4
 
-require github.com/cespare/xxhash/v2 v2.3.0
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/dchest/siphash v1.2.3
+	github.com/zeebo/xxh3 v1.0.2
+)
+
+require github.com/klauspost/cpuid/v2 v2.0.12 // indirect
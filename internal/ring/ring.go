@@ -5,6 +5,7 @@ import (
 	"sort"
 
 	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
 )
 
 // Token represents a point on the hash ring belonging to a particular node.
@@ -24,6 +25,12 @@ type Ring struct {
 // Each node gets 'vnodes' virtual tokens placed around the ring.
 // 'seed' is used to produce deterministic token positions.
 func New(nodes []string, vnodes int, seed uint64) *Ring {
+	return NewWithHash(nodes, vnodes, seed, hash.XXH64)
+}
+
+// NewWithHash is like New but places tokens with the given hash function.
+// Callers must hash keys with the same function for lookups to agree.
+func NewWithHash(nodes []string, vnodes int, seed uint64, fn hash.Func) *Ring {
 	if vnodes <= 0 {
 		panic("ring: vnodes must be > 0")
 	}
@@ -39,7 +46,7 @@ func New(nodes []string, vnodes int, seed uint64) *Ring {
 	for i, id := range r.Nodes {
 		for v := 0; v < vnodes; v++ {
 			key := []byte(fmt.Sprintf("%s#%d-%d", id, v, seed))
-			h := hash.XXH64(key, seed)
+			h := fn(key, seed)
 			tokens = append(tokens, Token{
 				H:       h,
 				NodeIdx: i,
@@ -71,3 +78,16 @@ func (r *Ring) SuccessorIndex(h uint64) int {
 	}
 	return i
 }
+
+// ExportTokens returns a copy of the tokens, in ring order, for mappers
+// implementing routercore.TokenRing. A nil ring has no tokens.
+func (r *Ring) ExportTokens() []routercore.Token {
+	if r == nil {
+		return nil
+	}
+	out := make([]routercore.Token, len(r.Tokens))
+	for i, t := range r.Tokens {
+		out[i] = routercore.Token{Hash: t.H, NodeIdx: t.NodeIdx}
+	}
+	return out
+}
@@ -23,6 +23,11 @@ type StateResponse struct {
 	State *State `json:"state"`
 }
 
+// LayoutResponse is the response for GET /layout.
+type LayoutResponse struct {
+	Layout *Layout `json:"layout"`
+}
+
 // AddNodeRequest is the request for POST /add-node.
 type AddNodeRequest struct {
 	// Empty for now, could add node ID later
@@ -97,6 +102,22 @@ func (a *API) HandleState(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, StateResponse{State: state})
 }
 
+// HandleLayout returns the real node layout of the current algorithm: ring
+// tokens, Maglev slot ownership or Jump buckets.
+func (a *API) HandleLayout(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		handleCORS(w)
+		return
+	}
+	if r.Method != http.MethodGet {
+		handleCORS(w)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	respondJSON(w, LayoutResponse{Layout: a.manager.GetLayout()})
+}
+
 // HandleCompareOperation runs an operation on all algorithms and returns comparison data.
 func (a *API) HandleCompareOperation(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodOptions {
@@ -358,4 +379,3 @@ func respondJSON(w http.ResponseWriter, data interface{}) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
-
@@ -0,0 +1,143 @@
+package visualizer
+
+import (
+	"math"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+// Layout describes where the current mapper really places nodes: the vnode
+// tokens of ring and CH-BL, the slot ownership of Maglev's lookup table,
+// or Jump's buckets. Other mappers only fill in Algorithm.
+type Layout struct {
+	Algorithm string             `json:"algorithm"`
+	Tokens    []RingToken        `json:"tokens,omitempty"`  // ring, chbl: in ring order
+	Slots     *SlotLayout        `json:"slots,omitempty"`   // maglev
+	Buckets   []JumpBucket       `json:"buckets,omitempty"` // jump
+	Ownership map[string]float64 `json:"ownership"`         // node → fraction of the hash space, slots or buckets it owns
+}
+
+// RingToken is one vnode token on the ring.
+type RingToken struct {
+	Hash     uint64  `json:"hash,string"` // a string: JSON numbers lose precision above 2^53
+	Position float64 `json:"position"`    // Hash as a fraction of the ring (0..1)
+	Node     string  `json:"node"`
+	Share    float64 `json:"share"` // fraction of the ring between the previous token and this one
+}
+
+// SlotLayout summarizes Maglev's lookup table.
+type SlotLayout struct {
+	TableSize int            `json:"tableSize"`
+	Slots     map[string]int `json:"slots"` // node → slots owned
+}
+
+// JumpBucket is one Jump bucket; keys hash uniformly over the buckets.
+type JumpBucket struct {
+	Bucket int    `json:"bucket"`
+	Node   string `json:"node"`
+}
+
+// GetLayout returns the layout of the current mapper.
+func (m *Manager) GetLayout() *Layout {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mapper == nil {
+		m.rebuild()
+	}
+	return m.layout()
+}
+
+// layout computes the mapper's layout; callers must hold m.mu.
+func (m *Manager) layout() *Layout {
+	l := &Layout{
+		Algorithm: string(m.algo),
+		Ownership: make(map[string]float64),
+	}
+	if m.mapper == nil {
+		return l
+	}
+	nodes := m.mapper.Nodes()
+	if len(nodes) == 0 {
+		return l
+	}
+
+	ring, isRing := m.mapper.(routercore.TokenRing)
+	table, isTable := m.mapper.(routercore.SlotTable)
+	switch {
+	case isRing:
+		l.Tokens = ringTokens(ring.Tokens(), nodes)
+		for _, t := range l.Tokens {
+			l.Ownership[t.Node] += t.Share
+		}
+	case isTable:
+		slots := table.Slots()
+		l.Slots = &SlotLayout{TableSize: len(slots), Slots: make(map[string]int)}
+		for _, idx := range slots {
+			l.Slots.Slots[nodes[idx]]++
+		}
+		for node, n := range l.Slots.Slots {
+			l.Ownership[node] = float64(n) / float64(len(slots))
+		}
+	case m.algo == routercore.AlgoJump:
+		// bucket i is node i, and each bucket gets 1/n of the keys
+		for i, node := range nodes {
+			l.Buckets = append(l.Buckets, JumpBucket{Bucket: i, Node: node})
+			l.Ownership[node] = 1 / float64(len(nodes))
+		}
+	}
+	return l
+}
+
+// ringTokens converts the mapper's tokens, adding each token's position and
+// the share of the ring it owns.
+func ringTokens(tokens []routercore.Token, nodes []string) []RingToken {
+	out := make([]RingToken, len(tokens))
+	for i, t := range tokens {
+		share := 1.0
+		if len(tokens) > 1 {
+			prev := tokens[(i+len(tokens)-1)%len(tokens)].Hash
+			// unsigned subtraction wraps around the ring for the first token
+			share = float64(t.Hash-prev) / ringSize
+		}
+		out[i] = RingToken{
+			Hash:     t.Hash,
+			Position: float64(t.Hash) / ringSize,
+			Node:     nodes[t.NodeIdx],
+			Share:    share,
+		}
+	}
+	return out
+}
+
+const ringSize = float64(math.MaxUint64) + 1
+
+// keyPositioner returns a function placing keys on the circle (0..1): at
+// the ring position their lookup starts for ring and CH-BL, at their table
+// slot for Maglev, and at the hash Jump picks their bucket from. Other
+// mappers place every key at 0. Callers must hold m.mu.
+func (m *Manager) keyPositioner() func(key string) float64 {
+	switch mp := m.mapper.(type) {
+	case routercore.TokenRing:
+		return func(key string) float64 {
+			return float64(mp.RingHash(hash.StringKey(key))) / ringSize
+		}
+	case routercore.SlotTable:
+		size := float64(len(mp.Slots()))
+		return func(key string) float64 {
+			return (float64(mp.Slot(hash.StringKey(key))) + 0.5) / size
+		}
+	}
+	if m.algo == routercore.AlgoJump {
+		// the mapper was built with the same HashFunc, so it is valid;
+		// Jump hashes keys with seed 0
+		hasher, err := hash.NewHasher(m.opts.HashFunc)
+		if err == nil {
+			return func(key string) float64 {
+				return float64(hasher.Sum64(hash.StringKey(key), 0)) / ringSize
+			}
+		}
+	}
+	return func(string) float64 { return 0 }
+}
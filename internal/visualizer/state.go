@@ -5,7 +5,7 @@ import (
 	"math"
 	"sync"
 
-	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/metrics"
 	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router"
 	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router/chbl"
 	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
@@ -13,44 +13,46 @@ import (
 
 // State represents the current state of the visualization.
 type State struct {
-	Nodes         []string            `json:"nodes"`
-	Keys          []string            `json:"keys"`
-	Positions     map[string]float64  `json:"positions"`   // key/node → position (0..1 around circle)
-	Assignments   map[string]string   `json:"assignments"` // key → node
-	NodeAngles    map[string]float64  `json:"nodeAngles"`  // node → angle in radians
-	Algorithm     string              `json:"algorithm"`
-	Stats         *Statistics         `json:"stats,omitempty"` // Statistics for the last operation
-	CHBLConfig    *CHBLConfig         `json:"chblConfig,omitempty"` // CH-BL specific config
+	Nodes       []string           `json:"nodes"`
+	Keys        []string           `json:"keys"`
+	Positions   map[string]float64 `json:"positions"`   // key/node → position (0..1 around circle)
+	Assignments map[string]string  `json:"assignments"` // key → node
+	NodeAngles  map[string]float64 `json:"nodeAngles"`  // node → angle in radians
+	Algorithm   string             `json:"algorithm"`
+	Stats       *Statistics        `json:"stats,omitempty"`      // Statistics for the last operation
+	CHBLConfig  *CHBLConfig        `json:"chblConfig,omitempty"` // CH-BL specific config
+	Tokens      []RingToken        `json:"tokens,omitempty"`     // ring/CH-BL vnode tokens, in ring order
 }
 
 // CHBLConfig contains CH-BL algorithm configuration.
 type CHBLConfig struct {
-	LoadFactor    float64 `json:"loadFactor"`
-	ExpectedKeys  int     `json:"expectedKeys"`
-	CapacityPerNode int   `json:"capacityPerNode"`
+	LoadFactor      float64 `json:"loadFactor"`
+	ExpectedKeys    int     `json:"expectedKeys"`
+	CapacityPerNode int     `json:"capacityPerNode"`
 }
 
 // Statistics tracks key movement and distribution changes.
 type Statistics struct {
-	Operation        string            `json:"operation"`        // "add-node", "remove-node", "regenerate-keys", "set-algorithm"
-	TotalKeys        int               `json:"totalKeys"`
-	KeysMoved        int               `json:"keysMoved"`
-	KeysMovedPercent float64           `json:"keysMovedPercent"`
-	MovementByNode   map[string]int    `json:"movementByNode"`   // node → count of keys moved to/from
-	Distribution     map[string]int    `json:"distribution"`      // node → current key count
-	PreviousDist     map[string]int    `json:"previousDist"`     // node → previous key count
-	KeyMovements     []KeyMovement     `json:"keyMovements"`     // Detailed movements (limited to first 20)
+	Operation        string           `json:"operation"` // "add-node", "remove-node", "regenerate-keys", "set-algorithm"
+	TotalKeys        int              `json:"totalKeys"`
+	KeysMoved        int              `json:"keysMoved"`
+	KeysMovedPercent float64          `json:"keysMovedPercent"`
+	MovementByNode   map[string]int   `json:"movementByNode"`      // node → count of keys moved to/from
+	Distribution     map[string]int   `json:"distribution"`        // node → current key count
+	PreviousDist     map[string]int   `json:"previousDist"`        // node → previous key count
+	KeyMovements     []KeyMovement    `json:"keyMovements"`        // Detailed movements (limited to first 20)
+	LoadStats        *metrics.Summary `json:"loadStats,omitempty"` // Per-node load summary (mean, quantiles, max/avg)
 	// Capacity information for CH-BL
-	CapacityInfo     *CapacityInfo     `json:"capacityInfo,omitempty"` // CH-BL capacity details
+	CapacityInfo *CapacityInfo `json:"capacityInfo,omitempty"` // CH-BL capacity details
 }
 
 // CapacityInfo provides information about node capacity status for CH-BL.
 type CapacityInfo struct {
-	NodesAtCapacity  []string          `json:"nodesAtCapacity"`  // Nodes that are at capacity
-	UnassignedKeys   int               `json:"unassignedKeys"`  // Number of keys that couldn't be assigned
-	CapacityPerNode  map[string]int    `json:"capacityPerNode"` // node → capacity limit
-	CurrentLoad       map[string]int    `json:"currentLoad"`     // node → current load
-	LoadPercentage    map[string]float64 `json:"loadPercentage"`  // node → load percentage (0-100)
+	NodesAtCapacity []string           `json:"nodesAtCapacity"` // Nodes that are at capacity
+	UnassignedKeys  int                `json:"unassignedKeys"`  // Number of keys that couldn't be assigned
+	CapacityPerNode map[string]int     `json:"capacityPerNode"` // node → capacity limit
+	CurrentLoad     map[string]int     `json:"currentLoad"`     // node → current load
+	LoadPercentage  map[string]float64 `json:"loadPercentage"`  // node → load percentage (0-100)
 }
 
 // KeyMovement represents a single key moving from one node to another.
@@ -62,23 +64,23 @@ type KeyMovement struct {
 
 // Manager manages the visualizer state and router.
 type Manager struct {
-	mu            sync.RWMutex
-	mapper        routercore.Mapper
-	nodes         []string
-	keys          []string
-	algo          routercore.Algo
-	opts          routercore.Options
-	keyGen        int // counter for generating unique keys
+	mu              sync.RWMutex
+	mapper          routercore.Mapper
+	nodes           []string
+	keys            []string
+	algo            routercore.Algo
+	opts            routercore.Options
+	keyGen          int               // counter for generating unique keys
 	prevAssignments map[string]string // previous assignments for computing stats
 }
 
 // NewManager creates a new visualizer manager.
 func NewManager() *Manager {
 	m := &Manager{
-		nodes:          make([]string, 0),
-		keys:           make([]string, 0),
-		algo:           routercore.AlgoRing,
-		keyGen:         0,
+		nodes:           make([]string, 0),
+		keys:            make([]string, 0),
+		algo:            routercore.AlgoRing,
+		keyGen:          0,
 		prevAssignments: make(map[string]string),
 		opts: routercore.Options{
 			TableSize:     65537,
@@ -133,8 +135,8 @@ func (m *Manager) getStateWithStats(operation string, stats *Statistics) (*State
 		avg := float64(m.opts.ExpectedKeys) / float64(len(m.nodes))
 		capacityPerNode := int(math.Ceil(m.opts.LoadFactor * avg))
 		state.CHBLConfig = &CHBLConfig{
-			LoadFactor:     m.opts.LoadFactor,
-			ExpectedKeys:   m.opts.ExpectedKeys,
+			LoadFactor:      m.opts.LoadFactor,
+			ExpectedKeys:    m.opts.ExpectedKeys,
 			CapacityPerNode: capacityPerNode,
 		}
 	}
@@ -142,7 +144,8 @@ func (m *Manager) getStateWithStats(operation string, stats *Statistics) (*State
 	copy(state.Nodes, m.nodes)
 	copy(state.Keys, m.keys)
 
-	// Compute node positions (evenly spaced around circle)
+	// Compute node positions (evenly spaced around circle, so labels do not
+	// overlap; Tokens holds where the ring really places each node)
 	for i, node := range m.nodes {
 		angle := 2 * math.Pi * float64(i) / float64(len(m.nodes))
 		state.NodeAngles[node] = angle
@@ -151,6 +154,10 @@ func (m *Manager) getStateWithStats(operation string, stats *Statistics) (*State
 
 	// Compute key positions and assignments
 	if m.mapper != nil && len(m.nodes) > 0 {
+		if tr, ok := m.mapper.(routercore.TokenRing); ok {
+			state.Tokens = ringTokens(tr.Tokens(), m.mapper.Nodes())
+		}
+		position := m.keyPositioner()
 		for _, key := range m.keys {
 			// Use recover to handle potential panics from Pick
 			func() {
@@ -162,11 +169,8 @@ func (m *Manager) getStateWithStats(operation string, stats *Statistics) (*State
 				node := m.mapper.Pick([]byte(key))
 				state.Assignments[key] = node
 
-				// Compute key position based on hash
-				h := hash.XXH64([]byte(key), m.opts.HashSeed)
-				// Normalize hash to 0..1
-				position := float64(h) / float64(math.MaxUint64)
-				state.Positions[key] = position
+				// Key position as the mapper sees it
+				state.Positions[key] = position(key)
 			}()
 		}
 	}
@@ -208,7 +212,7 @@ func (m *Manager) computeStatistics(operation string) *Statistics {
 	if m.algo == routercore.AlgoCHBL && m.mapper != nil {
 		// Rebuild to reset load state
 		m.rebuild()
-		
+
 		// Ensure ExpectedKeys is sufficient before assigning
 		// Capacity per node = ceil(LoadFactor * ExpectedKeys / numNodes)
 		// Total capacity = numNodes * ceil(LoadFactor * ExpectedKeys / numNodes)
@@ -225,7 +229,7 @@ func (m *Manager) computeStatistics(operation string) *Statistics {
 				m.rebuild()
 			}
 		}
-		
+
 		// Pre-assign all keys to build up load state correctly
 		// This ensures capacity is respected as keys are assigned
 		currentAssignments := make(map[string]string)
@@ -241,7 +245,7 @@ func (m *Manager) computeStatistics(operation string) *Statistics {
 				}
 			}
 		}
-		
+
 		// Get capacity information from CH-BL mapper
 		if chblMapper, ok := m.mapper.(chbl.CHBLMapper); ok {
 			capacityStatus := chblMapper.GetCapacityStatus()
@@ -255,21 +259,21 @@ func (m *Manager) computeStatistics(operation string) *Statistics {
 		} else if unassignedKeys > 0 {
 			// If we have unassigned keys but can't get capacity status, create basic info
 			stats.CapacityInfo = &CapacityInfo{
-				UnassignedKeys: unassignedKeys,
+				UnassignedKeys:  unassignedKeys,
 				NodesAtCapacity: make([]string, 0),
 				CapacityPerNode: make(map[string]int),
 				CurrentLoad:     make(map[string]int),
-				LoadPercentage: make(map[string]float64),
+				LoadPercentage:  make(map[string]float64),
 			}
 		}
-		
+
 		// Now compute statistics from the assignments
 		for _, key := range m.keys {
 			currentNode, exists := currentAssignments[key]
 			if !exists || currentNode == "" {
 				continue
 			}
-			
+
 			stats.Distribution[currentNode]++
 			prevNode, hadPrevious := m.prevAssignments[key]
 			if hadPrevious && prevNode != currentNode {
@@ -288,7 +292,7 @@ func (m *Manager) computeStatistics(operation string) *Statistics {
 				stats.MovementByNode[currentNode]++
 			}
 		}
-		
+
 		// Update previous assignments using the assignments we computed (don't call Pick again!)
 		m.prevAssignments = currentAssignments
 	} else {
@@ -322,6 +326,14 @@ func (m *Manager) computeStatistics(operation string) *Statistics {
 		stats.KeysMovedPercent = float64(stats.KeysMoved) / float64(stats.TotalKeys) * 100
 	}
 
+	// Summarize per-node load; nodes without keys count as zero load
+	var load metrics.Accumulator
+	for _, node := range m.nodes {
+		load.Add(int64(stats.Distribution[node]))
+	}
+	loadStats := load.Summary()
+	stats.LoadStats = &loadStats
+
 	// For non-CH-BL algorithms, update previous assignments
 	// (CH-BL assignments are already updated in computeStatistics above)
 	if m.algo != routercore.AlgoCHBL {
@@ -383,15 +395,15 @@ func (m *Manager) SetCHBLConfig(loadFactor float64, expectedKeys int) error {
 
 // AlgorithmComparison represents the result of running an operation on one algorithm.
 type AlgorithmComparison struct {
-	Algorithm   string            `json:"algorithm"`
-	State       *State            `json:"state"`
-	Stats       *Statistics       `json:"stats"`
+	Algorithm string      `json:"algorithm"`
+	State     *State      `json:"state"`
+	Stats     *Statistics `json:"stats"`
 }
 
 // CompareOperation runs the same operation on all algorithms and returns comparison data.
 func (m *Manager) CompareOperation(operation string, nodeID string) ([]AlgorithmComparison, error) {
 	m.mu.Lock()
-	
+
 	// Save current state (we don't modify the original manager)
 	currentNodes := make([]string, len(m.nodes))
 	copy(currentNodes, m.nodes)
@@ -418,12 +430,12 @@ func (m *Manager) CompareOperation(operation string, nodeID string) ([]Algorithm
 	for _, algo := range algorithms {
 		// Create a temporary manager for this algorithm
 		tempManager := &Manager{
-			nodes:          make([]string, len(currentNodes)),
-			keys:           make([]string, len(currentKeys)),
-			algo:           algo,
-			keyGen:         currentKeyGen,
+			nodes:           make([]string, len(currentNodes)),
+			keys:            make([]string, len(currentKeys)),
+			algo:            algo,
+			keyGen:          currentKeyGen,
 			prevAssignments: make(map[string]string),
-			opts:           currentOpts,
+			opts:            currentOpts,
 		}
 		copy(tempManager.nodes, currentNodes)
 		copy(tempManager.keys, currentKeys)
@@ -528,7 +540,7 @@ func (m *Manager) AddNode() (string, *Statistics) {
 	nodeID := m.generateNodeID()
 	m.nodes = append(m.nodes, nodeID)
 	m.rebuild()
-	
+
 	stats := m.computeStatistics("add-node")
 	return nodeID, stats
 }
@@ -572,7 +584,7 @@ func (m *Manager) RegenerateKeys(count int) *Statistics {
 	for i := 0; i < count; i++ {
 		m.keys[i] = m.generateKey()
 	}
-	
+
 	// For CH-BL, ensure ExpectedKeys is at least as large as the key count
 	// Add some buffer (1.5x) to account for load factor
 	if m.algo == routercore.AlgoCHBL {
@@ -582,7 +594,7 @@ func (m *Manager) RegenerateKeys(count int) *Statistics {
 			m.rebuild()
 		}
 	}
-	
+
 	stats := m.computeStatistics("regenerate-keys")
 	return stats
 }
@@ -599,7 +611,7 @@ func (m *Manager) SetKeyCount(count int) *Statistics {
 			m.keys = append(m.keys, m.generateKey())
 		}
 	}
-	
+
 	// For CH-BL, ensure ExpectedKeys is at least as large as the key count
 	// Add some buffer (1.5x) to account for load factor
 	if m.algo == routercore.AlgoCHBL {
@@ -609,7 +621,7 @@ func (m *Manager) SetKeyCount(count int) *Statistics {
 			m.rebuild()
 		}
 	}
-	
+
 	stats := m.computeStatistics("set-key-count")
 	return stats
 }
@@ -640,4 +652,3 @@ func (m *Manager) generateKey() string {
 	m.keyGen++
 	return fmt.Sprintf("key-%d", id)
 }
-
@@ -0,0 +1,42 @@
+// Package cache provides the per-node caches used by the simulator's cache
+// mode.
+package cache
+
+import "container/list"
+
+// LRU is a fixed-capacity set of keys that evicts the least recently used
+// key when full. It is not safe for concurrent use.
+type LRU struct {
+	size  int
+	order *list.List               // front = most recently used
+	items map[string]*list.Element // key -> element holding the key
+}
+
+// NewLRU returns an empty cache holding at most size keys (at least one).
+func NewLRU(size int) *LRU {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU{size: size, order: list.New(), items: make(map[string]*list.Element, size)}
+}
+
+// Access looks key up and reports whether it was cached. Either way the
+// key ends up as the most recently used entry, evicting the least recently
+// used one if the cache was full.
+func (c *LRU) Access(key []byte) bool {
+	if e, ok := c.items[string(key)]; ok {
+		c.order.MoveToFront(e)
+		return true
+	}
+	if c.order.Len() == c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(string))
+	}
+	k := string(key)
+	c.items[k] = c.order.PushFront(k)
+	return false
+}
+
+// Len returns the number of cached keys.
+func (c *LRU) Len() int { return c.order.Len() }
@@ -0,0 +1,37 @@
+package cache
+
+import "testing"
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU(2)
+	for _, step := range []struct {
+		key string
+		hit bool
+	}{
+		{"a", false},
+		{"b", false},
+		{"a", true},  // a is now most recent
+		{"c", false}, // evicts b
+		{"a", true},
+		{"b", false}, // evicts c
+		{"c", false},
+	} {
+		if got := c.Access([]byte(step.key)); got != step.hit {
+			t.Fatalf("access %s: hit=%v, want %v", step.key, got, step.hit)
+		}
+	}
+	if c.Len() != 2 {
+		t.Fatalf("len %d, want 2", c.Len())
+	}
+}
+
+func TestLRUMinimumSize(t *testing.T) {
+	c := NewLRU(0)
+	c.Access([]byte("a"))
+	if !c.Access([]byte("a")) {
+		t.Fatal("a size-0 cache should still hold one key")
+	}
+	if c.Access([]byte("b")); c.Len() != 1 {
+		t.Fatalf("len %d, want 1", c.Len())
+	}
+}
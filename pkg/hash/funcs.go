@@ -0,0 +1,145 @@
+package hash
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"github.com/dchest/siphash"
+	"github.com/zeebo/xxh3"
+)
+
+// Func is a seeded 64-bit hash over bytes. Routers use one Func for both
+// key hashing and node/token placement.
+type Func func(data []byte, seed uint64) uint64
+
+// Names accepted by ByName.
+const (
+	NameXXH64   = "xxh64"
+	NameXXH3    = "xxh3"
+	NameMurmur3 = "murmur3"
+	NameFNV1a   = "fnv1a"
+	NameSipHash = "siphash"
+	NameCRC32   = "crc32"
+	NameKetama  = "md5-ketama"
+)
+
+// ErrUnknownHash is returned by ByName for unsupported names.
+var ErrUnknownHash = errors.New("hash: unknown hash function")
+
+var funcs = map[string]Func{
+	NameXXH64:   XXH64,
+	NameXXH3:    XXH3,
+	NameMurmur3: Murmur3,
+	NameFNV1a:   FNV1a,
+	NameSipHash: SipHash,
+	NameCRC32:   CRC32,
+	NameKetama:  MD5Ketama,
+}
+
+// Names lists the supported hash functions in a stable order.
+func Names() []string {
+	return []string{NameXXH64, NameXXH3, NameMurmur3, NameFNV1a, NameSipHash, NameCRC32, NameKetama}
+}
+
+// ByName returns the hash function registered under name.
+// The empty name selects XXH64, the historical default.
+func ByName(name string) (Func, error) {
+	if name == "" {
+		return XXH64, nil
+	}
+	f, ok := funcs[name]
+	if !ok {
+		return nil, ErrUnknownHash
+	}
+	return f, nil
+}
+
+// XXH3 is the 64-bit XXH3 hash with its native seed.
+func XXH3(data []byte, seed uint64) uint64 {
+	return xxh3.HashSeed(data, seed)
+}
+
+// Murmur3 returns the first 64 bits of MurmurHash3 x64_128. Murmur3 only
+// takes a 32-bit seed, so the two halves of seed are folded together.
+func Murmur3(data []byte, seed uint64) uint64 {
+	return murmur3Sum64(data, uint32(seed^(seed>>32)))
+}
+
+// SipHash is SipHash-2-4 keyed with (seed, seed^altKey). Being a keyed PRF,
+// it resists inputs crafted to collide when the seed is kept secret.
+func SipHash(data []byte, seed uint64) uint64 {
+	const altKey = 0x9e3779b97f4a7c15
+	return siphash.Hash(seed, seed^altKey, data)
+}
+
+// The functions below are unseeded by design. With seed == 0 they produce
+// the standard digest, so results match other languages' implementations;
+// a non-zero seed is prepended as 8 little-endian bytes, like XXH64.
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// FNV1a is 64-bit FNV-1a.
+func FNV1a(data []byte, seed uint64) uint64 {
+	h := uint64(fnvOffset64)
+	if seed != 0 {
+		var s [8]byte
+		binary.LittleEndian.PutUint64(s[:], seed)
+		for _, c := range s {
+			h ^= uint64(c)
+			h *= fnvPrime64
+		}
+	}
+	for _, c := range data {
+		h ^= uint64(c)
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// CRC32 is the IEEE CRC-32 checksum widened to 64 bits. Only the low 32
+// bits are ever set, so ring positions live in [0, 2^32) as in ketama-style
+// 32-bit rings.
+func CRC32(data []byte, seed uint64) uint64 {
+	var crc uint32
+	if seed != 0 {
+		// Fold the seed prefix in with a table loop; a stack buffer passed
+		// to crc32.Update would escape to the heap.
+		crc = ^crc32Bytes(^crc, seed)
+	}
+	return uint64(crc32.Update(crc, crc32.IEEETable, data))
+}
+
+// MD5Ketama returns the first 8 bytes of the MD5 digest, little-endian.
+// The low 32 bits equal the libketama point for the same input.
+//
+// It digests with md5.Sum, which does not allocate: the seed prefix and
+// the key are joined in a stack buffer. Only seeded keys longer than
+// md5KetamaBuf-8 bytes fall back to a heap-allocated streaming digest.
+func MD5Ketama(data []byte, seed uint64) uint64 {
+	if seed == 0 {
+		sum := md5.Sum(data)
+		return binary.LittleEndian.Uint64(sum[:8])
+	}
+	if len(data) <= md5KetamaBuf-8 {
+		var buf [md5KetamaBuf]byte
+		binary.LittleEndian.PutUint64(buf[:8], seed)
+		n := 8 + copy(buf[8:], data)
+		sum := md5.Sum(buf[:n])
+		return binary.LittleEndian.Uint64(sum[:8])
+	}
+	d := md5.New()
+	var s [8]byte
+	binary.LittleEndian.PutUint64(s[:], seed)
+	d.Write(s[:])
+	d.Write(data)
+	var sum [md5.Size]byte
+	return binary.LittleEndian.Uint64(d.Sum(sum[:0]))
+}
+
+// md5KetamaBuf is the stack buffer MD5Ketama joins the seed and key in.
+const md5KetamaBuf = 256
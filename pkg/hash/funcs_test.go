@@ -0,0 +1,90 @@
+package hash
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestByNameAll(t *testing.T) {
+	for _, name := range Names() {
+		f, err := ByName(name)
+		if err != nil {
+			t.Fatalf("ByName(%q): %v", name, err)
+		}
+		if f([]byte("hello"), 42) != f([]byte("hello"), 42) {
+			t.Fatalf("%s: not deterministic", name)
+		}
+		if f([]byte("hello"), 1) == f([]byte("hello"), 2) {
+			t.Fatalf("%s: seed has no effect", name)
+		}
+	}
+	if _, err := ByName("nope"); err != ErrUnknownHash {
+		t.Fatalf("expected ErrUnknownHash, got %v", err)
+	}
+}
+
+func TestUnseededMatchStandardDigests(t *testing.T) {
+	cases := []struct {
+		name string
+		f    Func
+		in   string
+		want uint64
+	}{
+		{NameFNV1a, FNV1a, "", 0xcbf29ce484222325},
+		{NameFNV1a, FNV1a, "a", 0xaf63dc4c8601ec8c},
+		{NameCRC32, CRC32, "123456789", 0xcbf43926},
+		{NameKetama, MD5Ketama, "", 0x04b2008fd98c1dd4},
+		{NameXXH3, XXH3, "", 0x2d06800538d394c2},
+		{NameMurmur3, Murmur3, "hello", 0xcbd8a7b341bd9b02},
+	}
+	for _, c := range cases {
+		if got := c.f([]byte(c.in), 0); got != c.want {
+			t.Fatalf("%s(%q) = %#x, want %#x", c.name, c.in, got, c.want)
+		}
+	}
+}
+
+// MD5Ketama joins short seeded keys on the stack and streams long ones;
+// both must digest seed || key.
+func TestMD5KetamaSeededLengths(t *testing.T) {
+	for _, n := range []int{0, md5KetamaBuf - 8, md5KetamaBuf - 7, 1000} {
+		data := []byte(strings.Repeat("k", n))
+		in := binary.LittleEndian.AppendUint64(nil, 42)
+		sum := md5.Sum(append(in, data...))
+		if got, want := MD5Ketama(data, 42), binary.LittleEndian.Uint64(sum[:8]); got != want {
+			t.Fatalf("%d-byte key: got %#x, want %#x", n, got, want)
+		}
+	}
+}
+
+func TestHasherKeyKindsAgree(t *testing.T) {
+	for _, name := range Names() {
+		h, err := NewHasher(name)
+		if err != nil {
+			t.Fatalf("NewHasher(%q): %v", name, err)
+		}
+		for _, seed := range []uint64{0, 42} {
+			if h.Sum64(StringKey("key-77"), seed) != h.Sum64(BytesKey([]byte("key-77")), seed) {
+				t.Fatalf("%s: string and bytes keys disagree (seed %d)", name, seed)
+			}
+			le := []byte{0x4d, 0x3c, 0x2b, 0x1a, 0, 0, 0, 0}
+			if h.Sum64(Uint64Key(0x1a2b3c4d), seed) != h.Sum64(BytesKey(le), seed) {
+				t.Fatalf("%s: uint64 and bytes keys disagree (seed %d)", name, seed)
+			}
+		}
+	}
+}
+
+func TestHasherNoAllocs(t *testing.T) {
+	for _, name := range Names() {
+		h, _ := NewHasher(name)
+		if n := testing.AllocsPerRun(100, func() { h.Sum64(StringKey("key-77"), 42) }); n != 0 {
+			t.Fatalf("%s: string key allocated %.1f times", name, n)
+		}
+		if n := testing.AllocsPerRun(100, func() { h.Sum64(Uint64Key(77), 42) }); n != 0 {
+			t.Fatalf("%s: uint64 key allocated %.1f times", name, n)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package hash
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"hash/crc32"
+	"unsafe"
+)
+
+type keyKind uint8
+
+const (
+	kindBytes keyKind = iota
+	kindString
+	kindUint64
+)
+
+// Key is a borrowed view of a routing key. It lets routers hash strings
+// and integers without first converting them to a fresh []byte.
+//
+// Equivalent encodings hash identically: StringKey(s) matches
+// BytesKey([]byte(s)), and Uint64Key(v) matches BytesKey of v's 8-byte
+// little-endian encoding.
+type Key struct {
+	b    []byte
+	s    string
+	u    uint64
+	kind keyKind
+}
+
+// BytesKey wraps a byte-slice key. The slice must not be modified while
+// the Key is in use.
+func BytesKey(b []byte) Key { return Key{b: b, kind: kindBytes} }
+
+// StringKey wraps a string key without copying it.
+func StringKey(s string) Key { return Key{s: s, kind: kindString} }
+
+// Uint64Key wraps an integer key, hashed as 8 little-endian bytes.
+func Uint64Key(v uint64) Key { return Key{u: v, kind: kindUint64} }
+
+// Hasher is a hash function resolved by name, with allocation-free
+// hashing of every Key kind.
+type Hasher struct {
+	name string
+	fn   Func
+}
+
+// NewHasher returns the Hasher for a name accepted by ByName.
+func NewHasher(name string) (Hasher, error) {
+	if name == "" {
+		name = NameXXH64
+	}
+	fn, err := ByName(name)
+	if err != nil {
+		return Hasher{}, err
+	}
+	return Hasher{name: name, fn: fn}, nil
+}
+
+// Name returns the hash function's name.
+func (h Hasher) Name() string { return h.name }
+
+// Func returns the underlying byte-slice hash function.
+func (h Hasher) Func() Func { return h.fn }
+
+// Sum64 hashes k with the given seed.
+func (h Hasher) Sum64(k Key, seed uint64) uint64 {
+	switch k.kind {
+	case kindString:
+		// Zero-copy view of the string; hash functions never write to
+		// or retain their input.
+		return h.fn(unsafe.Slice(unsafe.StringData(k.s), len(k.s)), seed)
+	case kindUint64:
+		return h.sumUint64(k.u, seed)
+	default:
+		return h.fn(k.b, seed)
+	}
+}
+
+// sumUint64 calls the concrete hash directly so the 8-byte buffer stays on
+// the stack; passing it through h.fn would make it escape.
+func (h Hasher) sumUint64(v, seed uint64) uint64 {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+
+	switch h.name {
+	case NameXXH64:
+		return XXH64(b[:], seed)
+	case NameXXH3:
+		return XXH3(b[:], seed)
+	case NameMurmur3:
+		return Murmur3(b[:], seed)
+	case NameFNV1a:
+		return FNV1a(b[:], seed)
+	case NameSipHash:
+		return SipHash(b[:], seed)
+	case NameCRC32:
+		return crc32Uint64(v, seed)
+	case NameKetama:
+		return md5KetamaUint64(v, seed)
+	default:
+		return h.fn(binary.LittleEndian.AppendUint64(nil, v), seed)
+	}
+}
+
+var crc32Table = crc32.IEEETable
+
+// crc32Uint64 is CRC32 for an 8-byte key, computed with a plain table loop
+// (crc32.Update dispatches through a function pointer, which would move
+// the buffer to the heap).
+func crc32Uint64(v, seed uint64) uint64 {
+	crc := ^uint32(0)
+	if seed != 0 {
+		crc = crc32Bytes(crc, seed)
+	}
+	return uint64(^crc32Bytes(crc, v))
+}
+
+// crc32Bytes feeds the 8 little-endian bytes of v into a running
+// (pre-inverted) CRC32 state.
+func crc32Bytes(crc uint32, v uint64) uint32 {
+	for i := 0; i < 8; i++ {
+		crc = crc32Table[byte(crc)^byte(v>>(8*i))] ^ (crc >> 8)
+	}
+	return crc
+}
+
+// md5KetamaUint64 is MD5Ketama for an 8-byte key using md5.Sum on a stack
+// buffer instead of a heap-allocated digest.
+func md5KetamaUint64(v, seed uint64) uint64 {
+	var buf [16]byte
+	in := buf[:8]
+	if seed != 0 {
+		binary.LittleEndian.PutUint64(buf[:8], seed)
+		in = buf[:16]
+		binary.LittleEndian.PutUint64(buf[8:], v)
+	} else {
+		binary.LittleEndian.PutUint64(buf[:8], v)
+	}
+	sum := md5.Sum(in)
+	return binary.LittleEndian.Uint64(sum[:8])
+}
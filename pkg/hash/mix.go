@@ -0,0 +1,11 @@
+package hash
+
+// Mix64 is the splitmix64 finalizer: a bijective mix of a 64-bit value in
+// which every input bit affects every output bit. Routers use it to derive
+// independent-looking hashes from ones already computed (HRW scores, Jump
+// retries) without hashing the key again.
+func Mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
@@ -0,0 +1,14 @@
+package hash
+
+import "testing"
+
+func TestMix64MatchesSplitmix64(t *testing.T) {
+	// the first two outputs of splitmix64 seeded with 0
+	var gamma uint64 = 0x9e3779b97f4a7c15
+	if got := Mix64(gamma); got != 0xe220a8397b1dcdaf {
+		t.Fatalf("Mix64(gamma) = %#x", got)
+	}
+	if got := Mix64(2 * gamma); got != 0x6e789e6aa1b965f4 {
+		t.Fatalf("Mix64(2*gamma) = %#x", got)
+	}
+}
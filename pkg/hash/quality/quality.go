@@ -0,0 +1,257 @@
+// Package quality measures statistical properties of the hash functions in
+// pkg/hash: avalanche (strict avalanche criterion), bit independence,
+// chi-square bucket uniformity and raw collisions, over configurable key
+// patterns.
+package quality
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+)
+
+// Pattern selects how test keys are generated.
+type Pattern string
+
+const (
+	PatternSequential Pattern = "sequential" // "key-0", "key-1", ...
+	PatternUUID       Pattern = "uuid"       // random RFC 4122 v4 strings
+	PatternShortInt   Pattern = "shortint"   // 4-byte little-endian integers 0..n-1
+)
+
+// ErrUnknownPattern is returned by Keys for unsupported patterns.
+var ErrUnknownPattern = errors.New("quality: unknown key pattern")
+
+// Patterns lists the supported key patterns.
+func Patterns() []Pattern {
+	return []Pattern{PatternSequential, PatternUUID, PatternShortInt}
+}
+
+// Keys generates n distinct keys following pattern p. seed only affects
+// random patterns (UUIDs).
+func Keys(p Pattern, n int, seed int64) ([][]byte, error) {
+	keys := make([][]byte, n)
+	switch p {
+	case PatternSequential:
+		for i := range keys {
+			keys[i] = []byte(fmt.Sprintf("key-%d", i))
+		}
+	case PatternUUID:
+		rng := rand.New(rand.NewSource(seed))
+		seen := make(map[[16]byte]struct{}, n)
+		for i := 0; i < n; {
+			var u [16]byte
+			rng.Read(u[:])
+			u[6] = (u[6] & 0x0f) | 0x40 // version 4
+			u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+			if _, dup := seen[u]; dup {
+				continue
+			}
+			seen[u] = struct{}{}
+			keys[i] = []byte(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]))
+			i++
+		}
+	case PatternShortInt:
+		for i := range keys {
+			b := make([]byte, 4)
+			binary.LittleEndian.PutUint32(b, uint32(i))
+			keys[i] = b
+		}
+	default:
+		return nil, ErrUnknownPattern
+	}
+	return keys, nil
+}
+
+// Config controls the cost and resolution of a Run.
+type Config struct {
+	// Buckets is the number of buckets for the chi-square test.
+	Buckets int
+
+	// AvalancheSamples is how many keys are used for the avalanche and
+	// bit-independence tests; every input bit of each sampled key is
+	// flipped once.
+	AvalancheSamples int
+
+	// Seed is passed to the hash function.
+	Seed uint64
+}
+
+// Report holds the results for one hash over one key set.
+type Report struct {
+	Keys int
+
+	// AvalancheMeanBias is the mean over output bits of |P(flip) - 0.5|
+	// when a single input bit is flipped. 0 is ideal.
+	AvalancheMeanBias float64
+	// AvalancheWorstBias is the largest |P(flip) - 0.5| over every
+	// (input bit position, output bit) pair.
+	AvalancheWorstBias float64
+
+	// BICMaxCorrelation is the largest absolute correlation between the
+	// flip indicators of two output bits (bit independence criterion).
+	BICMaxCorrelation float64
+
+	// ChiSquare is the chi-square statistic of h % Buckets over all keys,
+	// with ChiSquareDF degrees of freedom. ChiSquareZ normalizes it as
+	// (chi2 - df) / sqrt(2 df); |z| above ~3 suggests non-uniformity.
+	ChiSquare   float64
+	ChiSquareDF int
+	ChiSquareZ  float64
+
+	// Collisions64 counts keys whose full 64-bit hash equals an earlier
+	// key's; Collisions32 does the same for the low 32 bits.
+	Collisions64 int
+	Collisions32 int
+}
+
+// Run evaluates fn over keys. Keys are assumed distinct.
+func Run(fn hash.Func, keys [][]byte, cfg Config) Report {
+	r := Report{Keys: len(keys)}
+	if len(keys) == 0 {
+		return r
+	}
+	if cfg.Buckets <= 0 {
+		cfg.Buckets = 1024
+	}
+	if cfg.AvalancheSamples <= 0 {
+		cfg.AvalancheSamples = 200
+	}
+
+	hashes := make([]uint64, len(keys))
+	for i, k := range keys {
+		hashes[i] = fn(k, cfg.Seed)
+	}
+
+	r.ChiSquare, r.ChiSquareDF = chiSquare(hashes, cfg.Buckets)
+	r.ChiSquareZ = (r.ChiSquare - float64(r.ChiSquareDF)) / math.Sqrt(2*float64(r.ChiSquareDF))
+	r.Collisions64, r.Collisions32 = collisions(hashes)
+
+	samples := keys
+	if len(samples) > cfg.AvalancheSamples {
+		// spread samples over the whole key set
+		step := len(keys) / cfg.AvalancheSamples
+		samples = make([][]byte, 0, cfg.AvalancheSamples)
+		for i := 0; i < len(keys) && len(samples) < cfg.AvalancheSamples; i += step {
+			samples = append(samples, keys[i])
+		}
+	}
+	r.AvalancheMeanBias, r.AvalancheWorstBias, r.BICMaxCorrelation = avalanche(fn, samples, cfg.Seed)
+	return r
+}
+
+func chiSquare(hashes []uint64, buckets int) (float64, int) {
+	counts := make([]int, buckets)
+	for _, h := range hashes {
+		counts[h%uint64(buckets)]++
+	}
+	expected := float64(len(hashes)) / float64(buckets)
+	var chi2 float64
+	for _, c := range counts {
+		d := float64(c) - expected
+		chi2 += d * d / expected
+	}
+	return chi2, buckets - 1
+}
+
+func collisions(hashes []uint64) (int, int) {
+	seen64 := make(map[uint64]struct{}, len(hashes))
+	seen32 := make(map[uint32]struct{}, len(hashes))
+	c64, c32 := 0, 0
+	for _, h := range hashes {
+		if _, ok := seen64[h]; ok {
+			c64++
+		} else {
+			seen64[h] = struct{}{}
+		}
+		if _, ok := seen32[uint32(h)]; ok {
+			c32++
+		} else {
+			seen32[uint32(h)] = struct{}{}
+		}
+	}
+	return c64, c32
+}
+
+// avalanche flips every input bit of every sample key and tracks which
+// output bits change. It returns the mean and worst SAC bias and the
+// largest pairwise output-bit correlation (BIC).
+func avalanche(fn hash.Func, samples [][]byte, seed uint64) (meanBias, worstBias, bicMax float64) {
+	maxBits := 0
+	for _, k := range samples {
+		if len(k)*8 > maxBits {
+			maxBits = len(k) * 8
+		}
+	}
+	if maxBits == 0 {
+		return 0, 0, 0
+	}
+
+	// perPos[i][j]: flips of output bit j when input bit i was flipped
+	perPos := make([][64]int, maxBits)
+	posTrials := make([]int, maxBits)
+	var flips [64]int
+	var both [64][64]int
+	trials := 0
+
+	buf := make([]byte, 0, maxBits/8)
+	for _, k := range samples {
+		base := fn(k, seed)
+		buf = append(buf[:0], k...)
+		for i := 0; i < len(k)*8; i++ {
+			buf[i/8] ^= 1 << (i % 8)
+			diff := base ^ fn(buf, seed)
+			buf[i/8] ^= 1 << (i % 8)
+
+			trials++
+			posTrials[i]++
+			for d := diff; d != 0; d &= d - 1 {
+				j := bits.TrailingZeros64(d)
+				flips[j]++
+				perPos[i][j]++
+				for e := d & (d - 1); e != 0; e &= e - 1 {
+					both[j][bits.TrailingZeros64(e)]++
+				}
+			}
+		}
+	}
+
+	n := float64(trials)
+	for j := 0; j < 64; j++ {
+		meanBias += math.Abs(float64(flips[j])/n - 0.5)
+	}
+	meanBias /= 64
+
+	for i := range perPos {
+		if posTrials[i] == 0 {
+			continue
+		}
+		for j := 0; j < 64; j++ {
+			if b := math.Abs(float64(perPos[i][j])/float64(posTrials[i]) - 0.5); b > worstBias {
+				worstBias = b
+			}
+		}
+	}
+
+	for j := 0; j < 64; j++ {
+		for k := j + 1; k < 64; k++ {
+			cj, ck := float64(flips[j]), float64(flips[k])
+			den := math.Sqrt(cj * (n - cj) * ck * (n - ck))
+			if den == 0 {
+				// a bit that never (or always) flips is perfectly dependent
+				bicMax = 1
+				continue
+			}
+			corr := math.Abs((n*float64(both[j][k]) - cj*ck) / den)
+			if corr > bicMax {
+				bicMax = corr
+			}
+		}
+	}
+	return meanBias, worstBias, bicMax
+}
@@ -0,0 +1,60 @@
+package quality
+
+import (
+	"testing"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+)
+
+func TestXXH64SequentialKeysLookRandom(t *testing.T) {
+	keys, err := Keys(PatternSequential, 20000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Run(hash.XXH64, keys, Config{Buckets: 256, AvalancheSamples: 100, Seed: 42})
+
+	if r.Collisions64 != 0 {
+		t.Fatalf("unexpected 64-bit collisions: %d", r.Collisions64)
+	}
+	if r.ChiSquareZ > 5 {
+		t.Fatalf("bucket distribution looks skewed: z=%.2f", r.ChiSquareZ)
+	}
+	if r.AvalancheMeanBias > 0.01 {
+		t.Fatalf("avalanche bias too high: %.4f", r.AvalancheMeanBias)
+	}
+}
+
+func TestBadHashIsFlagged(t *testing.T) {
+	identity := func(data []byte, seed uint64) uint64 {
+		var h uint64
+		for _, c := range data {
+			h = h<<8 | uint64(c)
+		}
+		return h
+	}
+	keys, _ := Keys(PatternShortInt, 4096, 1)
+	r := Run(identity, keys, Config{Buckets: 256, AvalancheSamples: 100})
+
+	if r.AvalancheMeanBias < 0.4 {
+		t.Fatalf("identity hash should fail avalanche, bias=%.4f", r.AvalancheMeanBias)
+	}
+	if r.BICMaxCorrelation < 0.99 {
+		t.Fatalf("identity hash should fail BIC, corr=%.4f", r.BICMaxCorrelation)
+	}
+}
+
+func TestKeysDistinct(t *testing.T) {
+	for _, p := range Patterns() {
+		keys, err := Keys(p, 5000, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := map[string]bool{}
+		for _, k := range keys {
+			if seen[string(k)] {
+				t.Fatalf("%s: duplicate key %q", p, k)
+			}
+			seen[string(k)] = true
+		}
+	}
+}
@@ -11,22 +11,34 @@ import (
 //   - xxHash64 itself does not take a seed in the constructor.
 //   - Prepending the seed as 8 bytes to the input is a common,
 //     production-safe pattern to ensure deterministic variation.
+//   - xxhash.NewWithSeed (native seeding) produces different values, so
+//     switching to it would remap every key; the prefix scheme is kept.
 //
 // Why 64-bit:
 //   - All our routing algorithms (Jump, Maglev, CH-BL) benefit from
 //     a uniformly distributed 64-bit space.
 func XXH64(data []byte, seed uint64) uint64 {
-	b := make([]byte, 8+len(data))
-	binary.LittleEndian.PutUint64(b[:8], seed)
-	copy(b[8:], data)
-	return xxhash.Sum64(b)
+	// Stream the seed prefix and the key through a stack-allocated digest
+	// instead of copying both into a fresh buffer. The output is identical
+	// to xxhash.Sum64(seedLE || data).
+	var d xxhash.Digest
+	d.Reset()
+	var s [8]byte
+	binary.LittleEndian.PutUint64(s[:], seed)
+	d.Write(s[:])
+	d.Write(data)
+	return d.Sum64()
 }
 
 // XXH64String is a convenience wrapper around XXH64 for string keys.
-// Using this avoids repeated []byte(key) allocations all over the code.
+// Like XXH64 it does not allocate, and it avoids the []byte(key)
+// conversion callers would otherwise need.
 func XXH64String(s string, seed uint64) uint64 {
-	b := make([]byte, 8+len(s))
-	binary.LittleEndian.PutUint64(b[:8], seed)
-	copy(b[8:], s)
-	return xxhash.Sum64(b)
+	var d xxhash.Digest
+	d.Reset()
+	var p [8]byte
+	binary.LittleEndian.PutUint64(p[:], seed)
+	d.Write(p[:])
+	d.WriteString(s)
+	return d.Sum64()
 }
@@ -17,3 +17,55 @@ func TestXXH64DifferentSeeds(t *testing.T) {
 		t.Fatalf("expected different seeds to produce different hashes")
 	}
 }
+
+// xxh64Golden holds outputs of the original seed-prefix implementation
+// (xxhash.Sum64 over an 8-byte little-endian seed followed by the data).
+// Every mapping in results/ depends on these values staying put.
+var xxh64Golden = []struct {
+	in   string
+	seed uint64
+	want uint64
+}{
+	{"", 0x0, 0x34c96acdcadb1bbb},
+	{"hello", 0x0, 0x169000852d224b72},
+	{"hello", 0x2a, 0x8c844deaa6534399},
+	{"key-12345", 0x1, 0x55f8d67fb2b26317},
+	{"node-3#17-42", 0x2a, 0xec027c41e98077f1},
+	{"the quick brown fox jumps over the lazy dog, repeatedly, to exceed thirty-two bytes", 0x9e3779b97f4a7c15, 0x122eec990958ad95},
+}
+
+func TestXXH64Golden(t *testing.T) {
+	for _, g := range xxh64Golden {
+		if got := XXH64([]byte(g.in), g.seed); got != g.want {
+			t.Fatalf("XXH64(%q, %#x) = %#x, want %#x", g.in, g.seed, got, g.want)
+		}
+		if got := XXH64String(g.in, g.seed); got != g.want {
+			t.Fatalf("XXH64String(%q, %#x) = %#x, want %#x", g.in, g.seed, got, g.want)
+		}
+	}
+}
+
+func TestXXH64NoAllocs(t *testing.T) {
+	key := []byte("key-12345")
+	if n := testing.AllocsPerRun(100, func() { XXH64(key, 42) }); n != 0 {
+		t.Fatalf("XXH64 allocated %.1f times per call", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { XXH64String("key-12345", 42) }); n != 0 {
+		t.Fatalf("XXH64String allocated %.1f times per call", n)
+	}
+}
+
+func BenchmarkXXH64(b *testing.B) {
+	key := []byte("key-1234567")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		XXH64(key, 42)
+	}
+}
+
+func BenchmarkXXH64String(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		XXH64String("key-1234567", 42)
+	}
+}
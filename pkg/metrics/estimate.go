@@ -0,0 +1,65 @@
+package metrics
+
+import "math"
+
+// Estimate summarises repeated measurements of one quantity, e.g. the CV
+// of the same experiment run with different seeds.
+type Estimate struct {
+	N      int
+	Mean   float64
+	Std    float64 // sample standard deviation (n-1 denominator)
+	CILow  float64 // 95% confidence interval for the mean
+	CIHigh float64
+}
+
+// EstimateMean returns the mean of xs with a two-sided 95% Student-t
+// confidence interval. With fewer than two samples the interval collapses
+// to the mean.
+func EstimateMean(xs []float64) Estimate {
+	e := Estimate{N: len(xs)}
+	if e.N == 0 {
+		return e
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	e.Mean = sum / float64(e.N)
+	e.CILow, e.CIHigh = e.Mean, e.Mean
+	if e.N < 2 {
+		return e
+	}
+
+	var sq float64
+	for _, x := range xs {
+		d := x - e.Mean
+		sq += d * d
+	}
+	e.Std = math.Sqrt(sq / float64(e.N-1))
+	half := tCritical95(e.N-1) * e.Std / math.Sqrt(float64(e.N))
+	e.CILow, e.CIHigh = e.Mean-half, e.Mean+half
+	return e
+}
+
+// t975 holds the 0.975 quantile of Student's t for 1..30 degrees of freedom.
+var t975 = [...]float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tCritical95 returns the two-sided 95% critical value of Student's t.
+// Beyond the table it uses the Cornish-Fisher expansion around z = 1.96,
+// which is accurate to three decimals for df > 30.
+func tCritical95(df int) float64 {
+	if df <= 0 {
+		return math.NaN()
+	}
+	if df <= len(t975) {
+		return t975[df-1]
+	}
+	const z = 1.959964
+	v := float64(df)
+	z3, z5 := z*z*z, z*z*z*z*z
+	return z + (z3+z)/(4*v) + (5*z5+16*z3+3*z)/(96*v*v)
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimateMean(t *testing.T) {
+	e := EstimateMean([]float64{1, 2, 3, 4, 5})
+	if e.N != 5 || e.Mean != 3 {
+		t.Fatalf("expected n=5 mean=3, got %+v", e)
+	}
+	if math.Abs(e.Std-math.Sqrt(2.5)) > 1e-12 {
+		t.Fatalf("expected sample std sqrt(2.5), got %f", e.Std)
+	}
+	// t(0.975, 4) = 2.776
+	half := 2.776 * math.Sqrt(2.5) / math.Sqrt(5)
+	if math.Abs(e.CILow-(3-half)) > 1e-9 || math.Abs(e.CIHigh-(3+half)) > 1e-9 {
+		t.Fatalf("unexpected interval [%f, %f]", e.CILow, e.CIHigh)
+	}
+
+	if one := EstimateMean([]float64{7}); one.CILow != 7 || one.CIHigh != 7 || one.Std != 0 {
+		t.Fatalf("single sample should collapse the interval, got %+v", one)
+	}
+}
+
+func TestTCritical95(t *testing.T) {
+	// reference values: t(0.975, 40) = 2.021, t(0.975, 120) = 1.980
+	for _, c := range []struct {
+		df   int
+		want float64
+	}{{30, 2.042}, {40, 2.021}, {120, 1.980}} {
+		if got := tCritical95(c.df); math.Abs(got-c.want) > 1e-3 {
+			t.Fatalf("df=%d: got %f, want %f", c.df, got, c.want)
+		}
+	}
+}
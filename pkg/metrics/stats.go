@@ -1,52 +1,207 @@
 package metrics
 
-import "math"
+import (
+	"math"
+	"sort"
+)
 
-// IntStats holds simple aggregate statistics over integer data.
+// IntStats holds aggregate statistics over integer data, typically the
+// number of keys assigned to each node.
 type IntStats struct {
-	Count int
-	Sum   int
-	Mean  float64
-	Max   int
-	Std   float64
-	CV    float64 // coefficient of variation = Std / Mean
+	Count  int
+	Sum    int
+	Mean   float64
+	Min    int
+	Max    int
+	Median float64
+	P90    float64
+	P99    float64
+	Std    float64
+	CV     float64 // coefficient of variation = Std / Mean
+
+	// Fairness measures over the shares xs[i] / Sum.
+	MaxAvg    float64 // Max / Mean (peak-to-average)
+	MinAvg    float64 // Min / Mean
+	Gini      float64 // 0 = perfectly even, (n-1)/n = all load on one node
+	Jain      float64 // Jain's index (Σx)² / (n·Σx²); 1 = perfectly even, 1/n = worst
+	Entropy   float64 // Shannon entropy of the shares, in bits
+	KLUniform float64 // KL divergence from uniform, in bits (= log2(n) - Entropy)
+}
+
+// FloatStats is IntStats over real-valued data, such as the request
+// weight carried by each node.
+type FloatStats struct {
+	Count  int
+	Sum    float64
+	Mean   float64
+	Min    float64
+	Max    float64
+	Median float64
+	P90    float64
+	P99    float64
+	Std    float64
+	CV     float64
+
+	MaxAvg    float64
+	MinAvg    float64
+	Gini      float64
+	Jain      float64
+	Entropy   float64
+	KLUniform float64
 }
 
-// ComputeIntStats computes basic statistics over a slice of ints.
+// ComputeIntStats computes statistics over a slice of ints.
 //
-// It returns zeroed stats if xs is empty.
+// It returns zeroed stats if xs is empty. Ratio and fairness fields stay
+// zero when every value is zero.
 func ComputeIntStats(xs []int) IntStats {
-	var st IntStats
+	fs := make([]float64, len(xs))
+	for i, v := range xs {
+		fs[i] = float64(v)
+	}
+	// exact: the sums of int loads stay far below 2^53
+	st := ComputeFloatStats(fs)
+	return IntStats{
+		Count: st.Count, Sum: int(st.Sum), Mean: st.Mean, Min: int(st.Min), Max: int(st.Max),
+		Median: st.Median, P90: st.P90, P99: st.P99, Std: st.Std, CV: st.CV,
+		MaxAvg: st.MaxAvg, MinAvg: st.MinAvg, Gini: st.Gini, Jain: st.Jain,
+		Entropy: st.Entropy, KLUniform: st.KLUniform,
+	}
+}
+
+// Float returns st as FloatStats.
+func (st IntStats) Float() FloatStats {
+	return FloatStats{
+		Count: st.Count, Sum: float64(st.Sum), Mean: st.Mean, Min: float64(st.Min), Max: float64(st.Max),
+		Median: st.Median, P90: st.P90, P99: st.P99, Std: st.Std, CV: st.CV,
+		MaxAvg: st.MaxAvg, MinAvg: st.MinAvg, Gini: st.Gini, Jain: st.Jain,
+		Entropy: st.Entropy, KLUniform: st.KLUniform,
+	}
+}
+
+// ComputeFloatStats computes statistics over a slice of non-negative
+// float64 values, as ComputeIntStats does over ints.
+func ComputeFloatStats(xs []float64) FloatStats {
+	var st FloatStats
 	n := len(xs)
 	if n == 0 {
 		return st
 	}
 	st.Count = n
 
-	// Sum and max
-	max := xs[0]
-	sum := 0
-	for _, v := range xs {
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+
+	// Sum, min and max
+	var sum float64
+	for _, v := range sorted {
 		sum += v
-		if v > max {
-			max = v
-		}
 	}
 	st.Sum = sum
-	st.Max = max
-	st.Mean = float64(sum) / float64(n)
+	st.Min = sorted[0]
+	st.Max = sorted[n-1]
+	st.Mean = sum / float64(n)
+
+	st.Median = quantileSorted(sorted, 0.5)
+	st.P90 = quantileSorted(sorted, 0.9)
+	st.P99 = quantileSorted(sorted, 0.99)
 
 	// Std dev
 	if n > 1 {
 		var sq float64
 		for _, v := range xs {
-			d := float64(v) - st.Mean
+			d := v - st.Mean
 			sq += d * d
 		}
 		st.Std = math.Sqrt(sq / float64(n))
 	}
-	if st.Mean != 0 {
-		st.CV = st.Std / st.Mean
+	if st.Mean == 0 {
+		return st
+	}
+	st.CV = st.Std / st.Mean
+	st.MaxAvg = st.Max / st.Mean
+	st.MinAvg = st.Min / st.Mean
+
+	// Gini over ascending values: (2·Σ i·x_i)/(n·Σx) - (n+1)/n, i from 1.
+	var weighted, sumSq float64
+	for i, v := range sorted {
+		weighted += float64(i+1) * v
+		sumSq += v * v
+	}
+	st.Gini = 2*weighted/(float64(n)*sum) - float64(n+1)/float64(n)
+	st.Jain = sum * sum / (float64(n) * sumSq)
+
+	st.Entropy = entropyBits(xs, sum)
+	st.KLUniform = math.Log2(float64(n)) - st.Entropy
+	if st.KLUniform < 0 {
+		st.KLUniform = 0 // rounding
 	}
 	return st
 }
+
+// KLDivergence returns KL(P || Q) in bits, where P is the observed load
+// shares xs[i] / Σxs and Q is the target shares weights[i] / Σweights.
+// A nil weights slice means a uniform target. It returns +Inf if some
+// node carries load but has zero target weight, and 0 if xs is empty or
+// all zero.
+func KLDivergence(xs []int, weights []float64) float64 {
+	if weights != nil && len(weights) != len(xs) {
+		panic("metrics: KLDivergence needs one weight per value")
+	}
+	sum := 0
+	for _, v := range xs {
+		sum += v
+	}
+	if sum == 0 {
+		return 0
+	}
+	wsum := float64(len(xs))
+	if weights != nil {
+		wsum = 0
+		for _, w := range weights {
+			wsum += w
+		}
+	}
+
+	var kl float64
+	for i, v := range xs {
+		if v == 0 {
+			continue
+		}
+		q := 1 / wsum
+		if weights != nil {
+			q = weights[i] / wsum
+		}
+		if q <= 0 {
+			return math.Inf(1)
+		}
+		p := float64(v) / float64(sum)
+		kl += p * math.Log2(p/q)
+	}
+	return kl
+}
+
+// entropyBits is the Shannon entropy of xs[i] / sum in bits.
+func entropyBits(xs []float64, sum float64) float64 {
+	var h float64
+	for _, v := range xs {
+		if v == 0 {
+			continue
+		}
+		p := v / sum
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// quantileSorted returns the q-quantile of ascending data, interpolating
+// linearly between the closest ranks.
+func quantileSorted(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(pos)
+	if lo+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(lo)
+	return sorted[lo] + frac*(sorted[lo+1]-sorted[lo])
+}
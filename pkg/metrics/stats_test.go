@@ -1,6 +1,9 @@
 package metrics
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestComputeIntStatsBasic(t *testing.T) {
 	xs := []int{1, 2, 3, 4}
@@ -18,3 +21,72 @@ func TestComputeIntStatsBasic(t *testing.T) {
 		t.Fatalf("expected mean=2.5, got %f", st.Mean)
 	}
 }
+
+func TestComputeIntStatsFairness(t *testing.T) {
+	even := ComputeIntStats([]int{5, 5, 5, 5})
+	if even.Gini != 0 || even.Jain != 1 || even.KLUniform != 0 || even.Entropy != 2 {
+		t.Fatalf("even load: gini=%f jain=%f kl=%f entropy=%f", even.Gini, even.Jain, even.KLUniform, even.Entropy)
+	}
+	if even.MaxAvg != 1 || even.MinAvg != 1 {
+		t.Fatalf("even load: max/avg=%f min/avg=%f", even.MaxAvg, even.MinAvg)
+	}
+
+	// All load on one of four nodes: the worst case for every measure.
+	skew := ComputeIntStats([]int{0, 0, 0, 8})
+	if math.Abs(skew.Gini-0.75) > 1e-12 {
+		t.Fatalf("expected gini=0.75, got %f", skew.Gini)
+	}
+	if skew.Jain != 0.25 {
+		t.Fatalf("expected jain=0.25, got %f", skew.Jain)
+	}
+	if skew.Entropy != 0 || skew.KLUniform != 2 {
+		t.Fatalf("expected entropy=0 kl=2, got %f %f", skew.Entropy, skew.KLUniform)
+	}
+	if skew.Min != 0 || skew.MaxAvg != 4 {
+		t.Fatalf("expected min=0 max/avg=4, got %d %f", skew.Min, skew.MaxAvg)
+	}
+}
+
+func TestComputeIntStatsQuantiles(t *testing.T) {
+	xs := make([]int, 101)
+	for i := range xs {
+		xs[i] = 100 - i // unsorted input
+	}
+	st := ComputeIntStats(xs)
+	if st.Median != 50 || st.P90 != 90 || st.P99 != 99 {
+		t.Fatalf("expected 50/90/99, got %f/%f/%f", st.Median, st.P90, st.P99)
+	}
+	if ComputeIntStats([]int{1, 2}).Median != 1.5 {
+		t.Fatalf("expected interpolated median 1.5")
+	}
+}
+
+func TestComputeFloatStatsKeepsFractions(t *testing.T) {
+	// rounded to ints these loads would read 0, 0, 1, 2
+	st := ComputeFloatStats([]float64{0.4, 0.4, 1.4, 1.6})
+	if math.Abs(st.Sum-3.8) > 1e-12 || st.Max != 1.6 || st.Min != 0.4 {
+		t.Fatalf("expected sum=3.8 max=1.6 min=0.4, got %f %f %f", st.Sum, st.Max, st.Min)
+	}
+	if st.CV == 0 || st.MaxAvg <= 1.6 {
+		t.Fatalf("expected uneven load, got cv=%f max/avg=%f", st.CV, st.MaxAvg)
+	}
+
+	// ints give the same statistics either way
+	ints := ComputeIntStats([]int{3, 1, 4, 1, 5})
+	if ComputeFloatStats([]float64{3, 1, 4, 1, 5}) != ints.Float() {
+		t.Fatalf("float and int statistics differ for integral data")
+	}
+}
+
+func TestKLDivergence(t *testing.T) {
+	xs := []int{10, 30}
+	if kl := KLDivergence(xs, []float64{1, 3}); math.Abs(kl) > 1e-12 {
+		t.Fatalf("load matching its target should have kl=0, got %f", kl)
+	}
+	if kl, want := KLDivergence(xs, nil), ComputeIntStats(xs).KLUniform; math.Abs(kl-want) > 1e-12 {
+		t.Fatalf("nil weights: got %f, want %f", kl, want)
+	}
+	if kl := KLDivergence(xs, []float64{1, 0}); !math.IsInf(kl, 1) {
+		t.Fatalf("load on a zero-weight node should be +Inf, got %f", kl)
+	}
+}
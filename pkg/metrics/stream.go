@@ -0,0 +1,239 @@
+package metrics
+
+import (
+	"math"
+	"math/bits"
+)
+
+// subBucketBits sets the histogram precision: each power-of-two range is
+// split into 2^(subBucketBits-1) buckets, so quantiles are accurate to
+// within 1/2^(subBucketBits-1) (under 1%) relative error. Values below
+// 2^subBucketBits are counted exactly.
+const subBucketBits = 7
+
+const subBucketHalf = 1 << (subBucketBits - 1)
+
+// Accumulator collects statistics over a stream of int64 samples without
+// storing them: Welford's algorithm for mean and variance, running
+// min/max/sum, and a log-linear (HDR-style) histogram for quantiles.
+//
+// An Accumulator is not safe for concurrent use. Give each goroutine its
+// own and combine them with Merge. The zero value is ready to use.
+type Accumulator struct {
+	n    int64
+	sum  int64
+	mean float64
+	m2   float64 // sum of squared deviations from the mean
+	min  int64
+	max  int64
+
+	pos []uint64 // histogram of samples >= 0
+	neg []uint64 // histogram of -sample for samples < 0
+}
+
+// Add records one sample.
+func (a *Accumulator) Add(v int64) {
+	a.AddN(v, 1)
+}
+
+// AddN records count copies of the sample v.
+func (a *Accumulator) AddN(v int64, count int64) {
+	if count <= 0 {
+		return
+	}
+	if a.n == 0 || v < a.min {
+		a.min = v
+	}
+	if a.n == 0 || v > a.max {
+		a.max = v
+	}
+
+	// Welford update, generalised to a batch of equal samples.
+	n := a.n + count
+	d := float64(v) - a.mean
+	a.mean += d * float64(count) / float64(n)
+	a.m2 += d * d * float64(a.n) * float64(count) / float64(n)
+	a.n = n
+	a.sum += v * count
+
+	if v >= 0 {
+		a.pos = addBucket(a.pos, uint64(v), uint64(count))
+	} else {
+		a.neg = addBucket(a.neg, uint64(-v), uint64(count))
+	}
+}
+
+// Merge folds the samples recorded in b into a (Chan et al.'s parallel
+// variance formula). b is left unchanged.
+func (a *Accumulator) Merge(b *Accumulator) {
+	if b.n == 0 {
+		return
+	}
+	if a.n == 0 || b.min < a.min {
+		a.min = b.min
+	}
+	if a.n == 0 || b.max > a.max {
+		a.max = b.max
+	}
+
+	n := a.n + b.n
+	d := b.mean - a.mean
+	a.m2 += b.m2 + d*d*float64(a.n)*float64(b.n)/float64(n)
+	a.mean += d * float64(b.n) / float64(n)
+	a.n = n
+	a.sum += b.sum
+
+	a.pos = mergeBuckets(a.pos, b.pos)
+	a.neg = mergeBuckets(a.neg, b.neg)
+}
+
+// Reset discards all samples, keeping the histogram storage.
+func (a *Accumulator) Reset() {
+	pos, neg := a.pos, a.neg
+	clear(pos)
+	clear(neg)
+	*a = Accumulator{pos: pos[:0], neg: neg[:0]}
+}
+
+// Count returns the number of samples.
+func (a *Accumulator) Count() int64 { return a.n }
+
+// Sum returns the sum of all samples.
+func (a *Accumulator) Sum() int64 { return a.sum }
+
+// Mean returns the exact mean, or 0 with no samples.
+func (a *Accumulator) Mean() float64 { return a.mean }
+
+// Min returns the smallest sample, or 0 with no samples.
+func (a *Accumulator) Min() int64 { return a.min }
+
+// Max returns the largest sample, or 0 with no samples.
+func (a *Accumulator) Max() int64 { return a.max }
+
+// Variance returns the population variance, matching IntStats.Std².
+func (a *Accumulator) Variance() float64 {
+	if a.n < 2 {
+		return 0
+	}
+	return a.m2 / float64(a.n)
+}
+
+// Std returns the population standard deviation.
+func (a *Accumulator) Std() float64 { return math.Sqrt(a.Variance()) }
+
+// Quantile returns an approximation of the q-quantile (0 <= q <= 1) using
+// the histogram. The result is exact for samples below 128 and within 1%
+// relative error otherwise, and always lies within [Min, Max].
+func (a *Accumulator) Quantile(q float64) float64 {
+	if a.n == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return float64(a.min)
+	}
+	if q >= 1 {
+		return float64(a.max)
+	}
+
+	// 1-based rank of the target sample, as in nearest-rank quantiles.
+	rank := uint64(math.Ceil(q * float64(a.n)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var v float64
+	var seen uint64
+	found := false
+	// Negative samples in ascending order are the neg buckets in reverse.
+	for i := len(a.neg) - 1; i >= 0 && !found; i-- {
+		if seen += a.neg[i]; seen >= rank {
+			v, found = -bucketMid(i), true
+		}
+	}
+	for i := 0; i < len(a.pos) && !found; i++ {
+		if seen += a.pos[i]; seen >= rank {
+			v, found = bucketMid(i), true
+		}
+	}
+	return math.Min(math.Max(v, float64(a.min)), float64(a.max))
+}
+
+// Summary is a snapshot of an Accumulator.
+type Summary struct {
+	Count  int64   `json:"count"`
+	Sum    int64   `json:"sum"`
+	Mean   float64 `json:"mean"`
+	Min    int64   `json:"min"`
+	Max    int64   `json:"max"`
+	Std    float64 `json:"std"`
+	CV     float64 `json:"cv"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+	P99    float64 `json:"p99"`
+	MaxAvg float64 `json:"maxAvg"`
+	MinAvg float64 `json:"minAvg"`
+}
+
+// Summary returns the current statistics. Quantiles are approximate; see
+// Quantile.
+func (a *Accumulator) Summary() Summary {
+	s := Summary{
+		Count:  a.n,
+		Sum:    a.sum,
+		Mean:   a.mean,
+		Min:    a.min,
+		Max:    a.max,
+		Std:    a.Std(),
+		Median: a.Quantile(0.5),
+		P90:    a.Quantile(0.9),
+		P99:    a.Quantile(0.99),
+	}
+	if s.Mean != 0 {
+		s.CV = s.Std / s.Mean
+		s.MaxAvg = float64(s.Max) / s.Mean
+		s.MinAvg = float64(s.Min) / s.Mean
+	}
+	return s
+}
+
+// bucketIndex maps a non-negative value to its histogram bucket. Values
+// below 2^subBucketBits map to themselves; larger values keep their top
+// subBucketBits bits, with shift selecting the power-of-two range.
+func bucketIndex(v uint64) int {
+	shift := bits.Len64(v) - subBucketBits
+	if shift <= 0 {
+		return int(v)
+	}
+	return shift*subBucketHalf + int(v>>uint(shift))
+}
+
+// bucketMid returns the midpoint of the values that map to bucket i.
+func bucketMid(i int) float64 {
+	if i < 2*subBucketHalf {
+		return float64(i)
+	}
+	shift := i/subBucketHalf - 1
+	top := i - shift*subBucketHalf
+	lo := float64(uint64(top) << uint(shift))
+	width := float64(uint64(1) << uint(shift))
+	return lo + (width-1)/2
+}
+
+func addBucket(h []uint64, v, count uint64) []uint64 {
+	i := bucketIndex(v)
+	if i >= len(h) {
+		h = append(h, make([]uint64, i+1-len(h))...)
+	}
+	h[i] += count
+	return h
+}
+
+func mergeBuckets(dst, src []uint64) []uint64 {
+	if len(src) > len(dst) {
+		dst = append(dst, make([]uint64, len(src)-len(dst))...)
+	}
+	for i, c := range src {
+		dst[i] += c
+	}
+	return dst
+}
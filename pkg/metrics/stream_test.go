@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAccumulatorMatchesIntStats(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	xs := make([]int, 10000)
+	var acc Accumulator
+	for i := range xs {
+		xs[i] = rng.Intn(50000)
+		acc.Add(int64(xs[i]))
+	}
+	st := ComputeIntStats(xs)
+
+	if acc.Count() != int64(st.Count) || acc.Sum() != int64(st.Sum) {
+		t.Fatalf("count/sum mismatch: %d/%d vs %d/%d", acc.Count(), acc.Sum(), st.Count, st.Sum)
+	}
+	if acc.Min() != int64(st.Min) || acc.Max() != int64(st.Max) {
+		t.Fatalf("min/max mismatch: %d/%d vs %d/%d", acc.Min(), acc.Max(), st.Min, st.Max)
+	}
+	if math.Abs(acc.Mean()-st.Mean) > 1e-9 || math.Abs(acc.Std()-st.Std) > 1e-6 {
+		t.Fatalf("mean/std mismatch: %f/%f vs %f/%f", acc.Mean(), acc.Std(), st.Mean, st.Std)
+	}
+	for _, c := range []struct {
+		q     float64
+		exact float64
+	}{{0.5, st.Median}, {0.9, st.P90}, {0.99, st.P99}} {
+		if got := acc.Quantile(c.q); math.Abs(got-c.exact)/c.exact > 0.02 {
+			t.Fatalf("q%.2f: got %f, exact %f", c.q, got, c.exact)
+		}
+	}
+}
+
+func TestAccumulatorMerge(t *testing.T) {
+	var whole, a, b Accumulator
+	for i := int64(-500); i < 1500; i++ {
+		v := i * 7
+		whole.Add(v)
+		if i%3 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+	}
+	a.Merge(&b)
+
+	if a.Count() != whole.Count() || a.Sum() != whole.Sum() || a.Min() != whole.Min() || a.Max() != whole.Max() {
+		t.Fatalf("merged count/sum/min/max differ: %+v vs %+v", a.Summary(), whole.Summary())
+	}
+	if math.Abs(a.Mean()-whole.Mean()) > 1e-9 || math.Abs(a.Variance()-whole.Variance()) > 1e-6 {
+		t.Fatalf("merged mean/variance differ: %f/%f vs %f/%f", a.Mean(), a.Variance(), whole.Mean(), whole.Variance())
+	}
+	for _, q := range []float64{0.01, 0.25, 0.5, 0.9} {
+		if a.Quantile(q) != whole.Quantile(q) {
+			t.Fatalf("q%.2f differs after merge: %f vs %f", q, a.Quantile(q), whole.Quantile(q))
+		}
+	}
+	if q := whole.Quantile(0.1); q >= 0 {
+		t.Fatalf("expected a negative 10th percentile, got %f", q)
+	}
+}
+
+func TestAccumulatorSmallValuesExact(t *testing.T) {
+	var acc Accumulator
+	acc.AddN(3, 2)
+	acc.AddN(9, 2)
+	if acc.Quantile(0.5) != 3 || acc.Quantile(0.75) != 9 || acc.Mean() != 6 || acc.Variance() != 9 {
+		t.Fatalf("unexpected summary %+v", acc.Summary())
+	}
+	acc.Reset()
+	if acc.Count() != 0 || acc.Quantile(0.5) != 0 {
+		t.Fatalf("Reset left samples behind: %+v", acc.Summary())
+	}
+}
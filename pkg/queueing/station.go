@@ -0,0 +1,82 @@
+// Package queueing simulates request queues in front of servers, to turn a
+// routing decision into latency.
+package queueing
+
+import "container/heap"
+
+// Station is a FIFO queue in front of a fixed number of identical servers
+// (a G/G/k queue). Requests must be offered in non-decreasing arrival
+// order; each is served by the first server to become free, so the
+// completion time of every request is known as soon as it arrives.
+type Station struct {
+	free     floatHeap // time each server next becomes free
+	inSystem floatHeap // completion times of requests not yet done
+	busy     float64   // total service time offered
+	last     float64   // latest completion
+	n        int
+}
+
+// NewStation returns a station with the given number of servers (at
+// least one).
+func NewStation(servers int) *Station {
+	if servers < 1 {
+		servers = 1
+	}
+	return &Station{free: make(floatHeap, servers)}
+}
+
+// Offer enqueues a request arriving at time arrival that needs service
+// time service. It returns the request's completion time and the number of
+// requests waiting for a server (not counting those in service) when it
+// arrived.
+func (s *Station) Offer(arrival, service float64) (done float64, queued int) {
+	// requests finished by now have left the system
+	for len(s.inSystem) > 0 && s.inSystem[0] <= arrival {
+		heap.Pop(&s.inSystem)
+	}
+	if queued = len(s.inSystem) - len(s.free); queued < 0 {
+		queued = 0
+	}
+
+	start := max(arrival, s.free[0])
+	done = start + service
+	s.free[0] = done
+	heap.Fix(&s.free, 0)
+	heap.Push(&s.inSystem, done)
+
+	s.n++
+	s.busy += service
+	s.last = max(s.last, done)
+	return done, queued
+}
+
+// Requests returns the number of requests offered.
+func (s *Station) Requests() int { return s.n }
+
+// Done returns the completion time of the last request to finish, or 0
+// before any request.
+func (s *Station) Done() float64 { return s.last }
+
+// Utilization returns the fraction of server time spent serving over a
+// window of length span (typically from time 0 to the Done time of the
+// whole simulation), or 0 if span is not positive.
+func (s *Station) Utilization(span float64) float64 {
+	if span <= 0 {
+		return 0
+	}
+	return s.busy / (span * float64(len(s.free)))
+}
+
+// floatHeap is a min-heap of times.
+type floatHeap []float64
+
+func (h floatHeap) Len() int           { return len(h) }
+func (h floatHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h floatHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *floatHeap) Push(x any)        { *h = append(*h, x.(float64)) }
+func (h *floatHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
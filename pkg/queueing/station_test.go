@@ -0,0 +1,60 @@
+package queueing
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestStationFIFO(t *testing.T) {
+	s := NewStation(1)
+	for _, c := range []struct {
+		arrival, service, done float64
+		queued                 int
+	}{
+		{0, 2, 2, 0},
+		{1, 2, 4, 0}, // waits for the first, which is in service
+		{1.5, 1, 5, 1},
+		{10, 1, 11, 0}, // idle server
+	} {
+		done, queued := s.Offer(c.arrival, c.service)
+		if done != c.done || queued != c.queued {
+			t.Fatalf("arrival %v: done %v queued %d, want %v and %d", c.arrival, done, queued, c.done, c.queued)
+		}
+	}
+	if u := s.Utilization(s.Done()); math.Abs(u-6.0/11) > 1e-9 {
+		t.Fatalf("utilization %v, want 6/11", u)
+	}
+}
+
+func TestStationParallelServers(t *testing.T) {
+	s := NewStation(2)
+	s.Offer(0, 5)
+	if done, _ := s.Offer(0, 5); done != 5 {
+		t.Fatalf("second server should start immediately, done at %v", done)
+	}
+	if done, queued := s.Offer(1, 1); done != 6 || queued != 0 {
+		t.Fatalf("third request done %v queued %d, want 6 and 0", done, queued)
+	}
+}
+
+// An M/M/1 queue with arrival rate λ and service rate μ has mean time in
+// system 1/(μ-λ).
+func TestStationMM1(t *testing.T) {
+	const lambda, mu = 0.8, 1.0
+	rng := rand.New(rand.NewSource(1))
+	s := NewStation(1)
+	var now, total float64
+	const n = 200000
+	for i := 0; i < n; i++ {
+		now += rng.ExpFloat64() / lambda
+		done, _ := s.Offer(now, rng.ExpFloat64()/mu)
+		total += done - now
+	}
+	if mean, want := total/n, 1/(mu-lambda); math.Abs(mean-want)/want > 0.1 {
+		t.Fatalf("mean latency %v, want about %v", mean, want)
+	}
+	if u := s.Utilization(s.Done()); math.Abs(u-lambda/mu) > 0.02 {
+		t.Fatalf("utilization %v, want about %v", u, lambda/mu)
+	}
+}
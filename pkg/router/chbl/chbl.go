@@ -21,19 +21,27 @@ type mapper struct {
 	nodes []string
 	ring  *ring.Ring
 
-	// per-node load and capacity
-	load            []int
-	capacityPerNode int
+	// per-node load and capacity, in keys or in request weight
+	load            []float64
+	totalLoad       float64
+	capacityPerNode float64
+	boundInFlight   bool // capacity follows totalLoad
 
 	// parameters
-	vnodes        int
-	loadFactor    float64
-	walkThreshold int
-	expectedKeys  int
+	vnodes         int
+	loadFactor     float64
+	walkThreshold  int
+	expectedKeys   int
+	expectedWeight float64
 
 	// hash seeds for first and second candidate
-	seed1 uint64
-	seed2 uint64
+	seed1  uint64
+	seed2  uint64
+	hasher hash.Hasher
+
+	// draining nodes have zero capacity for new assignments but keep
+	// the load they already carry
+	drain routercore.DrainSet
 }
 
 // CapacityStatus returns information about current capacity status.
@@ -52,13 +60,24 @@ type CapacityStatus struct {
 //
 // where c = opts.LoadFactor (default 1.25).
 // ExpectedKeys must be set by the caller for capacity guarantees to hold.
+// If opts.ExpectedWeight is set, C bounds the total request weight per
+// node instead (see PickIndexWeighted). With opts.BoundInFlight, C follows
+// the load currently carried, which callers lower with ReleaseIndex.
 func NewCHBL(nodes []string, opts routercore.Options) (routercore.Mapper, error) {
+	hasher, err := hash.NewHasher(opts.HashFunc)
+	if err != nil {
+		return nil, err
+	}
+
 	m := &mapper{
-		vnodes:        defaultOrInt(opts.Vnodes, defaultVnodes),
-		loadFactor:    defaultOrFloat(opts.LoadFactor, defaultLoadFactor),
-		walkThreshold: defaultOrInt(opts.WalkThreshold, defaultWalkThreshold),
-		expectedKeys:  opts.ExpectedKeys,
-		seed1:         opts.HashSeed,
+		vnodes:         defaultOrInt(opts.Vnodes, defaultVnodes),
+		loadFactor:     defaultOrFloat(opts.LoadFactor, defaultLoadFactor),
+		walkThreshold:  defaultOrInt(opts.WalkThreshold, defaultWalkThreshold),
+		expectedKeys:   opts.ExpectedKeys,
+		expectedWeight: opts.ExpectedWeight,
+		boundInFlight:  opts.BoundInFlight,
+		seed1:          opts.HashSeed,
+		hasher:         hasher,
 	}
 
 	// derive a distinct second seed for two-choice fallback
@@ -88,6 +107,7 @@ func defaultOrFloat(v, def float64) float64 {
 func (m *mapper) Add(nodes ...string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.drain.Clear(nodes...)
 	m.rebuild(append(m.nodes, nodes...))
 }
 
@@ -99,6 +119,7 @@ func (m *mapper) Remove(nodes ...string) {
 		return
 	}
 	removeSet := make(map[string]struct{}, len(nodes))
+	m.drain.Clear(nodes...)
 	for _, n := range nodes {
 		removeSet[n] = struct{}{}
 	}
@@ -113,8 +134,49 @@ func (m *mapper) Remove(nodes ...string) {
 	m.rebuild(kept)
 }
 
+// Drain sets the capacity of the given nodes to zero for new assignments.
+// Unlike Remove it does not rebuild the ring or reset load, so keys already
+// counted against a draining node stay there until the caller migrates them.
+func (m *mapper) Drain(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.drain.Drain(nodes...)
+	m.drain.Index(m.nodes, false)
+}
+
+// capacityOf returns the capacity of node i for new assignments: zero while
+// draining, capacityPerNode otherwise. Callers must hold m.mu.
+func (m *mapper) capacityOf(i int) float64 {
+	if m.drain.Drained(i) {
+		return 0
+	}
+	return m.capacityPerNode
+}
+
+// hasCapacity reports whether node i can take a request of the given
+// weight without exceeding its capacity. Nodes rejected by skip (if
+// non-nil) count as having no capacity.
+func (m *mapper) hasCapacity(i int, weight float64, skip func(idx int) bool) bool {
+	if skip != nil && skip(i) {
+		return false
+	}
+	return m.load[i]+weight <= m.capacityOf(i)
+}
+
+// belowCapacity reports whether node i is acceptable and not yet full,
+// whatever the weight of the next request.
+func (m *mapper) belowCapacity(i int, skip func(idx int) bool) bool {
+	if skip != nil && skip(i) {
+		return false
+	}
+	return m.load[i] < m.capacityOf(i)
+}
+
 // rebuild rebuilds the ring and resets load/capacity for the given nodes.
 func (m *mapper) rebuild(nodes []string) {
+	defer func() { m.drain.Index(m.nodes, false) }()
+
 	if len(nodes) == 0 {
 		m.nodes = nil
 		m.ring = nil
@@ -136,7 +198,7 @@ func (m *mapper) rebuild(nodes []string) {
 	m.nodes = uniq
 
 	// rebuild ring
-	m.ring = ring.New(m.nodes, m.vnodes, m.seed1)
+	m.ring = ring.NewWithHash(m.nodes, m.vnodes, m.seed1, m.hasher.Func())
 
 	// compute capacity C = ceil(c * m / n)
 	n := len(m.nodes)
@@ -145,10 +207,15 @@ func (m *mapper) rebuild(nodes []string) {
 		// the algorithm behaves reasonably; we default to avg * c for m = n.
 		m.expectedKeys = n
 	}
-	avg := float64(m.expectedKeys) / float64(n)
-	m.capacityPerNode = int(math.Ceil(m.loadFactor * avg))
+	total := float64(m.expectedKeys)
+	if m.expectedWeight > 0 {
+		total = m.expectedWeight
+	}
+	avg := total / float64(n)
+	m.capacityPerNode = math.Ceil(m.loadFactor * avg)
 
-	m.load = make([]int, n)
+	m.load = make([]float64, n)
+	m.totalLoad = 0
 }
 
 // Pick assigns the key to a node, enforcing the per-node capacity C and
@@ -157,9 +224,135 @@ func (m *mapper) rebuild(nodes []string) {
 // NOTE: This mapper is stateful over Pick calls (it tracks load).
 // Returns empty string if all nodes are at capacity.
 func (m *mapper) Pick(key []byte) string {
+	return m.pick(hash.BytesKey(key))
+}
+
+// PickString is Pick for a string key; it does not copy the key.
+func (m *mapper) PickString(key string) string {
+	return m.pick(hash.StringKey(key))
+}
+
+// PickUint64 is Pick for an integer key, hashed as 8 little-endian bytes.
+func (m *mapper) PickUint64(key uint64) string {
+	return m.pick(hash.Uint64Key(key))
+}
+
+func (m *mapper) pick(key hash.Key) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := m.pickIndex(key, 1, nil)
+	if idx < 0 {
+		return ""
+	}
+	return m.nodes[idx]
+}
+
+// PickIndex is like Pick but returns the node's index in Nodes(),
+// or -1 if all nodes are at capacity. It updates load the same way.
+func (m *mapper) PickIndex(key []byte) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pickIndex(hash.BytesKey(key), 1, nil)
+}
+
+// PickIndexWeighted is like PickIndex for a request of the given weight
+// (bytes, CPU units, ...): it counts weight instead of one key against the
+// node's capacity, and takes a node only if the request keeps it within C.
+// A request that fits on no node goes to the least-loaded node below C.
+// Mixing it with unit picks only makes sense when ExpectedWeight includes
+// the unit picks.
+func (m *mapper) PickIndexWeighted(key hash.Key, weight float64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pickIndex(key, weight, nil)
+}
+
+// PickIndexSkipping is like PickIndex but treats nodes rejected by skip as
+// having no capacity, so the walk and two-choice fallback pass over them.
+// It returns -1 if no acceptable node has capacity.
+func (m *mapper) PickIndexSkipping(key hash.Key, skip func(idx int) bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pickIndex(key, 1, skip)
+}
+
+// PickIndexWeightedSkipping is PickIndexWeighted with nodes rejected by
+// skip treated as full (see routercore.WeightedWalker).
+func (m *mapper) PickIndexWeightedSkipping(key hash.Key, weight float64, skip func(idx int) bool) int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	return m.pickIndex(key, weight, skip)
+}
+
+// PickIndexOverflow assigns key to the least-loaded acceptable node even if
+// it is at capacity (see routercore.OverflowPicker).
+func (m *mapper) PickIndexOverflow(key hash.Key, weight float64, skip func(idx int) bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.nodes) == 0 || m.ring == nil {
+		panic("chbl: no nodes registered")
+	}
+	return m.overflow(key, weight, skip)
+}
+
+// overflow assigns a request of the given weight to the least-loaded node
+// not rejected by skip, preferring non-draining nodes and breaking ties in
+// the key's ring order, or returns -1 if skip rejects every node; callers
+// must hold m.mu.
+func (m *mapper) overflow(key hash.Key, weight float64, skip func(idx int) bool) int {
+	best, bestDrained := -1, false
+	start := m.ring.SuccessorIndex(m.hasher.Sum64(key, m.seed1))
+	for i := 0; i < len(m.ring.Tokens); i++ {
+		nodeIdx := m.ring.Tokens[(start+i)%len(m.ring.Tokens)].NodeIdx
+		if skip != nil && skip(nodeIdx) {
+			continue
+		}
+		drained := m.drain.Drained(nodeIdx)
+		switch {
+		case best < 0,
+			bestDrained && !drained,
+			bestDrained == drained && m.load[nodeIdx] < m.load[best]:
+			best, bestDrained = nodeIdx, drained
+		}
+	}
+	if best >= 0 {
+		m.assign(best, weight)
+	}
+	return best
+}
+
+// Nodes returns a copy of the deduplicated node table.
+func (m *mapper) Nodes() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.nodes...)
+}
+
+// Tokens returns the ring's vnode tokens sorted by hash.
+func (m *mapper) Tokens() []routercore.Token {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.ring.ExportTokens()
+}
+
+// RingHash returns the ring position at which key's walk starts (the first
+// choice; the two-choice fallback uses a second seed).
+func (m *mapper) RingHash(key hash.Key) uint64 {
+	return m.hasher.Sum64(key, m.seed1)
+}
+
+// pickIndex performs the bounded-load assignment of a request of the given
+// weight, skipping nodes rejected by skip (nil accepts all); callers must
+// hold m.mu.
+func (m *mapper) pickIndex(key hash.Key, weight float64, skip func(idx int) bool) int {
 	if len(m.nodes) == 0 {
 		panic("chbl: no nodes registered")
 	}
@@ -167,7 +360,11 @@ func (m *mapper) Pick(key []byte) string {
 		panic("chbl: ring not initialized")
 	}
 
-	h1 := hash.XXH64(key, m.seed1)
+	if m.boundInFlight {
+		m.capacityPerNode = math.Ceil(m.loadFactor * (m.totalLoad + weight) / float64(len(m.nodes)))
+	}
+
+	h1 := m.hasher.Sum64(key, m.seed1)
 	idx := m.ring.SuccessorIndex(h1)
 	startIdx := idx
 	steps := 0
@@ -176,18 +373,18 @@ func (m *mapper) Pick(key []byte) string {
 		token := m.ring.Tokens[idx]
 		nodeIdx := token.NodeIdx
 
-		if m.load[nodeIdx] < m.capacityPerNode {
-			m.load[nodeIdx]++
-			return m.nodes[nodeIdx]
+		if m.hasCapacity(nodeIdx, weight, skip) {
+			m.assign(nodeIdx, weight)
+			return nodeIdx
 		}
 
 		steps++
 		// two-choice fallback if walk becomes too long
 		if steps == m.walkThreshold {
-			chosen := m.twoChoiceFallback(key, nodeIdx)
+			chosen := m.twoChoiceFallback(key, nodeIdx, weight, skip)
 			if chosen >= 0 {
-				m.load[chosen]++
-				return m.nodes[chosen]
+				m.assign(chosen, weight)
+				return chosen
 			}
 			// else continue walking from nodeIdx with smaller load
 		}
@@ -198,13 +395,46 @@ func (m *mapper) Pick(key []byte) string {
 			idx = 0
 		}
 		if idx == startIdx {
-			// We've looped around the whole ring and found no capacity.
-			// Return empty string instead of panicking
-			return ""
+			// We've looped around the whole ring and the request fits
+			// nowhere. If some node is still below C, the request is
+			// heavier than any headroom: it goes to the least-loaded such
+			// node. Otherwise every node is full and we return -1.
+			return m.overflow(key, weight, func(i int) bool { return !m.belowCapacity(i, skip) })
 		}
 	}
 }
 
+// assign counts a request of the given weight on node idx; callers must
+// hold m.mu.
+func (m *mapper) assign(idx int, weight float64) {
+	m.load[idx] += weight
+	m.totalLoad += weight
+}
+
+// ReleaseIndex removes a completed request of the given weight from node
+// idx's load (see routercore.LoadReleaser), never taking it below zero.
+// Add resets the loads, so requests picked before it must not be released.
+func (m *mapper) ReleaseIndex(idx int, weight float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if idx < 0 || idx >= len(m.load) {
+		return
+	}
+	weight = math.Min(weight, m.load[idx])
+	m.load[idx] -= weight
+	m.totalLoad -= weight
+}
+
+// ResetLoad drops every node's load (see routercore.LoadResetter).
+func (m *mapper) ResetLoad() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clear(m.load)
+	m.totalLoad = 0
+}
+
 // CHBLMapper is an interface for accessing CH-BL specific methods.
 type CHBLMapper interface {
 	GetCapacityStatus() CapacityStatus
@@ -219,20 +449,21 @@ func (m *mapper) GetCapacityStatus() CapacityStatus {
 		NodesAtCapacity: make([]string, 0),
 		CapacityPerNode: make(map[string]int),
 		CurrentLoad:     make(map[string]int),
-		LoadPercentage: make(map[string]float64),
+		LoadPercentage:  make(map[string]float64),
 	}
 
 	for i, node := range m.nodes {
-		status.CapacityPerNode[node] = m.capacityPerNode
-		status.CurrentLoad[node] = m.load[i]
-		
-		if m.capacityPerNode > 0 {
-			status.LoadPercentage[node] = float64(m.load[i]) / float64(m.capacityPerNode) * 100
+		capacity := m.capacityOf(i)
+		status.CapacityPerNode[node] = int(capacity)
+		status.CurrentLoad[node] = int(m.load[i])
+
+		if capacity > 0 {
+			status.LoadPercentage[node] = m.load[i] / capacity * 100
 		} else {
 			status.LoadPercentage[node] = 0
 		}
-		
-		if m.load[i] >= m.capacityPerNode {
+
+		if m.load[i] >= capacity {
 			status.NodesAtCapacity = append(status.NodesAtCapacity, node)
 		}
 	}
@@ -243,16 +474,16 @@ func (m *mapper) GetCapacityStatus() CapacityStatus {
 // twoChoiceFallback hashes the key again to get a second candidate and
 // returns the index of the better node (less loaded and with capacity),
 // or -1 if neither candidate has capacity.
-func (m *mapper) twoChoiceFallback(key []byte, primaryIdx int) int {
-	h2 := hash.XXH64(key, m.seed2)
+func (m *mapper) twoChoiceFallback(key hash.Key, primaryIdx int, weight float64, skip func(idx int) bool) int {
+	h2 := m.hasher.Sum64(key, m.seed2)
 	idx2 := m.ring.SuccessorIndex(h2)
 	nodeIdx2 := m.ring.Tokens[idx2].NodeIdx
 
 	// primary nodeIdx is the one we were walking from
 	nodeIdx1 := primaryIdx
 
-	has1 := m.load[nodeIdx1] < m.capacityPerNode
-	has2 := m.load[nodeIdx2] < m.capacityPerNode
+	has1 := m.hasCapacity(nodeIdx1, weight, skip)
+	has2 := m.hasCapacity(nodeIdx2, weight, skip)
 
 	if !has1 && !has2 {
 		return -1
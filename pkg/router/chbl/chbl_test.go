@@ -1,8 +1,11 @@
 package chbl
 
 import (
+	"fmt"
+	"math"
 	"testing"
 
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
 	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
 )
 
@@ -42,3 +45,173 @@ func TestCHBLRespectsCapacityBound(t *testing.T) {
 
 	// If we reach here without panic, basic behavior is OK.
 }
+
+func TestCHBLPickIndexFull(t *testing.T) {
+	// Two nodes, capacity ceil(1.0 * 2 / 2) = 1 each.
+	m, _ := NewCHBL([]string{"n1", "n2"}, routercore.Options{
+		LoadFactor:   1.0,
+		HashSeed:     42,
+		ExpectedKeys: 2,
+	})
+
+	first := m.PickIndex([]byte("a"))
+	second := m.PickIndex([]byte("b"))
+	if first < 0 || second < 0 || first == second {
+		t.Fatalf("expected both nodes to take one key, got %d and %d", first, second)
+	}
+	if idx := m.PickIndex([]byte("c")); idx != -1 {
+		t.Fatalf("expected -1 once all nodes are full, got %d", idx)
+	}
+	if n := m.Pick([]byte("d")); n != "" {
+		t.Fatalf("expected empty node once all nodes are full, got %q", n)
+	}
+
+	m.(routercore.LoadResetter).ResetLoad()
+	if idx := m.PickIndex([]byte("a")); idx != first {
+		t.Fatalf("expected key a back on %d after ResetLoad, got %d", first, idx)
+	}
+}
+
+func TestCHBLDrainStopsNewAssignments(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4"}
+	m, _ := NewCHBL(nodes, routercore.Options{
+		LoadFactor:   1.25,
+		HashSeed:     42,
+		ExpectedKeys: 1000,
+	})
+
+	for i := 0; i < 500; i++ {
+		m.Pick([]byte("old-" + string(rune(i))))
+	}
+	before := m.(CHBLMapper).GetCapacityStatus().CurrentLoad["n2"]
+
+	m.Drain("n2")
+	for i := 0; i < 400; i++ {
+		if n := m.Pick([]byte("new-" + string(rune(i)))); n == "n2" {
+			t.Fatalf("draining node received a new key")
+		}
+	}
+
+	status := m.(CHBLMapper).GetCapacityStatus()
+	if status.CurrentLoad["n2"] != before {
+		t.Fatalf("drain changed existing load: %d -> %d", before, status.CurrentLoad["n2"])
+	}
+	if status.CapacityPerNode["n2"] != 0 {
+		t.Fatalf("expected zero capacity while draining, got %d", status.CapacityPerNode["n2"])
+	}
+}
+
+func TestCHBLBoundsWeight(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4"}
+	// every tenth request is 100x heavier than the rest
+	weights := make([]float64, 10000)
+	var total float64
+	for i := range weights {
+		weights[i] = 1
+		if i%10 == 0 {
+			weights[i] = 100
+		}
+		total += weights[i]
+	}
+	m, _ := NewCHBL(nodes, routercore.Options{
+		LoadFactor:     1.05,
+		Vnodes:         10,
+		HashSeed:       42,
+		ExpectedKeys:   len(weights),
+		ExpectedWeight: total,
+	})
+
+	load := make([]float64, len(nodes))
+	for i, w := range weights {
+		idx := m.(routercore.WeightedPicker).PickIndexWeighted(hash.StringKey(fmt.Sprintf("k-%d", i)), w)
+		if idx < 0 {
+			t.Fatalf("request %d was not placed", i)
+		}
+		load[idx] += w
+	}
+
+	// a node takes a request only if it stays within C
+	bound := math.Ceil(1.05 * total / float64(len(nodes)))
+	for i, l := range load {
+		if l > bound {
+			t.Fatalf("node %s carries weight %.0f, bound %.0f", nodes[i], l, bound)
+		}
+	}
+}
+
+func TestCHBLPlacesRequestHeavierThanCapacity(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4"}
+	// C = ceil(1.25 * 400 / 4) = 125
+	m, _ := NewCHBL(nodes, routercore.Options{LoadFactor: 1.25, HashSeed: 42, ExpectedWeight: 400})
+	wp := m.(routercore.WeightedPicker)
+
+	light := wp.PickIndexWeighted(hash.StringKey("light"), 10)
+	heavy := wp.PickIndexWeighted(hash.StringKey("heavy"), 200)
+	if light < 0 || heavy < 0 {
+		t.Fatalf("expected both requests placed, got %d and %d", light, heavy)
+	}
+	if heavy == light {
+		t.Fatalf("heavy request went to node %s, which already carries weight; want the least-loaded node", nodes[heavy])
+	}
+
+	// the heavy node is now over C and takes nothing more
+	for i := 0; i < 100; i++ {
+		if idx := wp.PickIndexWeighted(hash.StringKey(fmt.Sprintf("k-%d", i)), 1); idx == heavy {
+			t.Fatalf("request %d went to node %s, which is over capacity", i, nodes[heavy])
+		}
+	}
+}
+
+func TestCHBLTokensMatchFirstChoice(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4"}
+	// a loose bound so every key lands on its first choice
+	m, _ := NewCHBL(nodes, routercore.Options{HashSeed: 42, Vnodes: 20, ExpectedKeys: 1 << 20})
+	tr := m.(routercore.TokenRing)
+	tokens := tr.Tokens()
+	if len(tokens) != len(nodes)*20 {
+		t.Fatalf("expected %d tokens, got %d", len(nodes)*20, len(tokens))
+	}
+
+	for i := 0; i < 500; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		h := tr.RingHash(hash.BytesKey(key))
+		owner := tokens[0].NodeIdx
+		for _, tok := range tokens {
+			if tok.Hash >= h {
+				owner = tok.NodeIdx
+				break
+			}
+		}
+		if got := m.PickIndex(key); got != owner {
+			t.Fatalf("key %q: PickIndex %d, successor token owner %d", key, got, owner)
+		}
+	}
+}
+
+func TestCHBLBoundInFlight(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4"}
+	m, _ := NewCHBL(nodes, routercore.Options{LoadFactor: 1.25, HashSeed: 42, BoundInFlight: true})
+	rel := m.(routercore.LoadReleaser)
+
+	// one hot key, 40 requests in flight: each completion is released, so
+	// its node never holds more than ceil(1.25 * 40 / 4) = 13 of them
+	const inFlight = 40
+	var window []int
+	load := make([]int, len(nodes))
+	for i := 0; i < 10000; i++ {
+		idx := m.PickIndex([]byte("hot"))
+		if idx < 0 {
+			t.Fatalf("request %d was not placed", i)
+		}
+		load[idx]++
+		if load[idx] > 13 {
+			t.Fatalf("request %d: node %s holds %d requests in flight", i, nodes[idx], load[idx])
+		}
+		window = append(window, idx)
+		if len(window) == inFlight {
+			rel.ReleaseIndex(window[0], 1)
+			load[window[0]]--
+			window = window[1:]
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package health
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+// ErrNoCandidateWalk is returned by New when the wrapped mapper cannot
+// skip nodes (it does not implement routercore.CandidateWalker).
+var ErrNoCandidateWalk = errors.New("health: mapper does not support candidate walking")
+
+// Mapper is a health overlay on top of any routercore.Mapper.
+//
+// Marking a node unhealthy does not touch the inner ring or table: Pick
+// asks the inner mapper for the best candidate that is not unhealthy
+// (ring successor, next slot of the key's Maglev probe, next HRW rank,
+// re-jumped bucket). Marking it healthy again restores the original
+// mapping exactly, so a flapping node causes no permanent remapping.
+//
+// Membership changes must go through the overlay so it can keep its
+// index -> health table in sync with the inner mapper.
+type Mapper struct {
+	mu       sync.RWMutex
+	inner    routercore.Mapper
+	walker   routercore.CandidateWalker
+	weighted routercore.WeightedWalker // nil unless inner counts request weights
+	overflow routercore.OverflowPicker // nil unless inner has capacity bounds
+
+	nodes     []string // cached inner node table
+	unhealthy map[string]struct{}
+	down      []bool // inner node index -> unhealthy; nil if none (or all)
+}
+
+// New wraps inner with a health overlay. All nodes start healthy.
+func New(inner routercore.Mapper) (*Mapper, error) {
+	walker, ok := inner.(routercore.CandidateWalker)
+	if !ok {
+		return nil, ErrNoCandidateWalk
+	}
+	m := &Mapper{
+		inner:     inner,
+		walker:    walker,
+		unhealthy: make(map[string]struct{}),
+	}
+	m.weighted, _ = inner.(routercore.WeightedWalker)
+	m.overflow, _ = inner.(routercore.OverflowPicker)
+	m.refresh()
+	return m, nil
+}
+
+// MarkUnhealthy excludes nodes from Pick until MarkHealthy is called.
+func (m *Mapper) MarkUnhealthy(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, n := range nodes {
+		m.unhealthy[n] = struct{}{}
+	}
+	m.refresh()
+}
+
+// MarkHealthy returns nodes to service.
+func (m *Mapper) MarkHealthy(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, n := range nodes {
+		delete(m.unhealthy, n)
+	}
+	m.refresh()
+}
+
+// Healthy reports whether node is currently considered healthy.
+func (m *Mapper) Healthy(node string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, down := m.unhealthy[node]
+	return !down
+}
+
+// Add registers nodes with the inner mapper. Health marks are kept, so a
+// node re-added while unhealthy stays out of rotation.
+func (m *Mapper) Add(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inner.Add(nodes...)
+	m.refresh()
+}
+
+// Remove unregisters nodes from the inner mapper and forgets their health.
+func (m *Mapper) Remove(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inner.Remove(nodes...)
+	for _, n := range nodes {
+		delete(m.unhealthy, n)
+	}
+	m.refresh()
+}
+
+// Drain forwards to the inner mapper.
+func (m *Mapper) Drain(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inner.Drain(nodes...)
+}
+
+func (m *Mapper) Pick(key []byte) string {
+	return m.pick(hash.BytesKey(key))
+}
+
+// PickString is Pick for a string key; it does not copy the key.
+func (m *Mapper) PickString(key string) string {
+	return m.pick(hash.StringKey(key))
+}
+
+// PickUint64 is Pick for an integer key, hashed as 8 little-endian bytes.
+func (m *Mapper) PickUint64(key uint64) string {
+	return m.pick(hash.Uint64Key(key))
+}
+
+func (m *Mapper) pick(key hash.Key) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx := m.pickIndex(key, 1)
+	if idx < 0 {
+		return ""
+	}
+	return m.nodes[idx]
+}
+
+// PickIndex returns the inner index of the best healthy candidate. If every
+// healthy node is at capacity (CH-BL), the least-loaded healthy node takes
+// the key. Only if every node is unhealthy is health ignored and the inner
+// mapper decides.
+func (m *Mapper) PickIndex(key []byte) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pickIndex(hash.BytesKey(key), 1)
+}
+
+// PickIndexWeighted is PickIndex for a request of the given weight: an
+// inner mapper that counts weights (CH-BL) counts it, others ignore it.
+func (m *Mapper) PickIndexWeighted(key hash.Key, weight float64) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pickIndex(key, weight)
+}
+
+// Nodes returns a copy of the inner mapper's node table.
+func (m *Mapper) Nodes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]string(nil), m.nodes...)
+}
+
+// pickIndex consults the inner mapper for a request of the given weight;
+// callers must hold m.mu.
+func (m *Mapper) pickIndex(key hash.Key, weight float64) int {
+	var skip func(idx int) bool
+	if m.down != nil {
+		skip = m.isDown
+	}
+	var idx int
+	if m.weighted != nil {
+		idx = m.weighted.PickIndexWeightedSkipping(key, weight, skip)
+	} else {
+		idx = m.walker.PickIndexSkipping(key, skip)
+	}
+	if idx >= 0 || skip == nil || m.overflow == nil {
+		return idx
+	}
+	return m.overflow.PickIndexOverflow(key, weight, skip)
+}
+
+func (m *Mapper) isDown(idx int) bool {
+	return m.down[idx]
+}
+
+// refresh recomputes per-index health flags against the inner node table.
+// down is left nil when no node, or every node, is unhealthy; callers must
+// hold m.mu.
+func (m *Mapper) refresh() {
+	m.down = nil
+	m.nodes = m.inner.Nodes()
+	count := 0
+	flags := make([]bool, len(m.nodes))
+	for i, n := range m.nodes {
+		if _, ok := m.unhealthy[n]; ok {
+			flags[i] = true
+			count++
+		}
+	}
+	if count > 0 && count < len(m.nodes) {
+		m.down = flags
+	}
+}
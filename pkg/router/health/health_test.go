@@ -0,0 +1,114 @@
+package health
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+func TestHealthFlapCausesNoPermanentRemap(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4", "n5"}
+	algos := []routercore.Algo{
+		routercore.AlgoJump,
+		routercore.AlgoMaglev,
+		routercore.AlgoRing,
+		routercore.AlgoHRW,
+	}
+
+	for _, algo := range algos {
+		inner, err := router.New(algo, routercore.Options{HashSeed: 7, TableSize: 1021}, nodes)
+		if err != nil {
+			t.Fatalf("%s: %v", algo, err)
+		}
+		m, err := New(inner)
+		if err != nil {
+			t.Fatalf("%s: %v", algo, err)
+		}
+
+		before := make([]string, 2000)
+		for i := range before {
+			before[i] = m.Pick([]byte("k-" + string(rune(i))))
+		}
+
+		m.MarkUnhealthy("n2")
+		for i := range before {
+			key := []byte("k-" + string(rune(i)))
+			got := m.Pick(key)
+			if got == "n2" {
+				t.Fatalf("%s: unhealthy node picked for %q", algo, key)
+			}
+			if before[i] != "n2" && got != before[i] {
+				t.Fatalf("%s: healthy key %q moved %s -> %s", algo, key, before[i], got)
+			}
+		}
+
+		m.MarkHealthy("n2")
+		for i := range before {
+			key := []byte("k-" + string(rune(i)))
+			if got := m.Pick(key); got != before[i] {
+				t.Fatalf("%s: key %q did not return after recovery: %s vs %s", algo, key, got, before[i])
+			}
+		}
+	}
+}
+
+func TestHealthCHBLKeepsKeysOffUnhealthyNodes(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d"}
+	const keys = 1000
+	inner, err := router.New(routercore.AlgoCHBL, routercore.Options{HashSeed: 7, ExpectedKeys: keys}, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the healthy nodes' bounds (sized for four nodes) fill up before
+	// every key is placed; the rest must still avoid d
+	m.MarkUnhealthy("d")
+	counts := map[string]int{}
+	for i := 0; i < keys; i++ {
+		counts[m.Pick([]byte(fmt.Sprintf("k-%d", i)))]++
+	}
+	if counts["d"] != 0 || counts[""] != 0 {
+		t.Fatalf("keys reached the unhealthy node or were dropped: %v", counts)
+	}
+	for _, n := range nodes[:3] {
+		if counts[n] < keys/3-1 || counts[n] > keys/3+1 {
+			t.Fatalf("overflow not spread over the healthy nodes: %v", counts)
+		}
+	}
+}
+
+func TestHealthForwardsWeightedPicks(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d"}
+	const keys, weight = 1000, 3.0
+	inner, err := router.New(routercore.AlgoCHBL, routercore.Options{HashSeed: 7, ExpectedWeight: keys * weight}, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.MarkUnhealthy("d")
+
+	load := map[string]float64{}
+	for i := 0; i < keys; i++ {
+		idx := m.PickIndexWeighted(hash.StringKey(fmt.Sprintf("k-%d", i)), weight)
+		load[nodes[idx]] += weight
+	}
+	// weights count against the bound, so the healthy nodes end up even
+	for _, n := range nodes[:3] {
+		if load[n] > keys*weight/3+weight {
+			t.Fatalf("%s carries %.0f of %.0f: %v", n, load[n], keys*weight, load)
+		}
+	}
+	if load["d"] != 0 {
+		t.Fatalf("unhealthy node carries weight: %v", load)
+	}
+}
@@ -0,0 +1,243 @@
+package hrw
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+// mapper implements rendezvous (highest random weight) hashing.
+//
+// Every node gets a score per key and the highest score wins. Ranking all
+// nodes by score gives a natural replica order, which PickN uses.
+type mapper struct {
+	mu       sync.RWMutex
+	nodes    []string
+	nodeHash []uint64 // per-node hash mixed into each key's score
+	hashSeed uint64
+	hasher   hash.Hasher
+	topology routercore.Topology
+	spread   routercore.Domain
+
+	drain routercore.DrainSet // draining nodes
+}
+
+// NewHRW constructs a rendezvous-hashing mapper.
+//
+// opts.HashSeed controls hashing; opts.Topology and opts.ReplicaSpread
+// control failure-domain spreading in PickN.
+func NewHRW(nodes []string, opts routercore.Options) (routercore.Mapper, error) {
+	hasher, err := hash.NewHasher(opts.HashFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mapper{
+		hashSeed: opts.HashSeed,
+		hasher:   hasher,
+		topology: opts.Topology,
+		spread:   opts.ReplicaSpread,
+	}
+	if err := m.topology.Validate(nodes, m.spread); err != nil {
+		return nil, err
+	}
+	m.rebuild(nodes)
+	return m, nil
+}
+
+// Add adds nodes. A node with no label at the ReplicaSpread level is its
+// own failure domain (see Topology.DomainOf); use AddLabeled to label new
+// nodes.
+func (m *mapper) Add(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(nodes)
+}
+
+// AddLabeled records labels for nodes and adds them (see
+// routercore.LabeledAdder).
+func (m *mapper) AddLabeled(labels routercore.Topology, nodes ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	topo := m.topology.Merge(labels)
+	if err := topo.Validate(nodes, m.spread); err != nil {
+		return err
+	}
+	m.topology = topo
+	m.add(nodes)
+	return nil
+}
+
+// add adds nodes; callers must hold m.mu.
+func (m *mapper) add(nodes []string) {
+	m.drain.Clear(nodes...)
+	m.rebuild(append(m.nodes, nodes...))
+}
+
+func (m *mapper) Remove(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.nodes) == 0 || len(nodes) == 0 {
+		return
+	}
+	removeSet := make(map[string]struct{}, len(nodes))
+	m.drain.Clear(nodes...)
+	for _, n := range nodes {
+		removeSet[n] = struct{}{}
+	}
+
+	var kept []string
+	for _, n := range m.nodes {
+		if _, drop := removeSet[n]; !drop {
+			kept = append(kept, n)
+		}
+	}
+	m.rebuild(kept)
+}
+
+// Drain keeps nodes registered but excludes them from the score ranking
+// used by Pick, so only the drained nodes' keys move.
+func (m *mapper) Drain(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.drain.Drain(nodes...)
+	m.drain.Index(m.nodes, true)
+}
+
+func (m *mapper) rebuild(nodes []string) {
+	defer func() { m.drain.Index(m.nodes, true) }()
+
+	// deduplicate nodes while preserving order
+	seen := make(map[string]struct{}, len(nodes))
+	var uniq []string
+	for _, n := range nodes {
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		uniq = append(uniq, n)
+	}
+	m.nodes = uniq
+
+	m.nodeHash = make([]uint64, len(m.nodes))
+	for i, id := range m.nodes {
+		m.nodeHash[i] = m.hasher.Sum64(hash.StringKey(id), m.hashSeed)
+	}
+}
+
+func (m *mapper) Pick(key []byte) string {
+	return m.pick(hash.BytesKey(key))
+}
+
+// PickString is Pick for a string key; it does not copy the key.
+func (m *mapper) PickString(key string) string {
+	return m.pick(hash.StringKey(key))
+}
+
+// PickUint64 is Pick for an integer key, hashed as 8 little-endian bytes.
+func (m *mapper) PickUint64(key uint64) string {
+	return m.pick(hash.Uint64Key(key))
+}
+
+func (m *mapper) pick(key hash.Key) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.nodes[m.pickIndex(key)]
+}
+
+// PickIndex returns the index in Nodes() of the highest-scoring node.
+func (m *mapper) PickIndex(key []byte) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pickIndex(hash.BytesKey(key))
+}
+
+// PickIndexSkipping is like PickIndex but also treats nodes rejected by
+// skip as unavailable. It returns -1 if every node is rejected.
+func (m *mapper) PickIndexSkipping(key hash.Key, skip func(idx int) bool) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pickIndexSkipping(key, m.drain.Skipping(skip))
+}
+
+// Nodes returns a copy of the deduplicated node table.
+func (m *mapper) Nodes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]string(nil), m.nodes...)
+}
+
+// PickN returns up to n distinct non-draining nodes for key in rank order,
+// so the first entry is the node Pick returns, spread across failure
+// domains when a ReplicaSpread level was configured.
+func (m *mapper) PickN(key []byte, n int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.nodes) == 0 {
+		panic("hrw: no nodes registered")
+	}
+
+	kh := m.hasher.Sum64(hash.BytesKey(key), m.hashSeed)
+	skip := m.drain.Skipping(nil)
+	order := make([]int, 0, len(m.nodes))
+	scores := make([]uint64, len(m.nodes))
+	for i := range m.nodes {
+		if skip != nil && skip(i) {
+			continue
+		}
+		order = append(order, i)
+		scores[i] = score(kh, m.nodeHash[i])
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	ranked := make([]string, len(order))
+	for i, idx := range order {
+		ranked[i] = m.nodes[idx]
+	}
+	return routercore.SpreadReplicas(ranked, n, m.topology, m.spread)
+}
+
+// pickIndex finds the highest-scoring non-draining node; callers must
+// hold m.mu.
+func (m *mapper) pickIndex(key hash.Key) int {
+	return m.pickIndexSkipping(key, m.drain.Skipping(nil))
+}
+
+// pickIndexSkipping returns the highest-scoring node whose index is not
+// rejected by skip (nil accepts all), or -1 if every node is rejected;
+// callers must hold m.mu.
+func (m *mapper) pickIndexSkipping(key hash.Key, skip func(idx int) bool) int {
+	if len(m.nodes) == 0 {
+		panic("hrw: no nodes registered")
+	}
+
+	kh := m.hasher.Sum64(key, m.hashSeed)
+	best := -1
+	var bestScore uint64
+	for i := range m.nodes {
+		if skip != nil && skip(i) {
+			continue
+		}
+		if s := score(kh, m.nodeHash[i]); best < 0 || s > bestScore {
+			best, bestScore = i, s
+		}
+	}
+	return best
+}
+
+// score mixes a key hash with a node hash, so each (key, node) pair gets an
+// independent-looking weight.
+func score(keyHash, nodeHash uint64) uint64 {
+	return hash.Mix64(keyHash ^ nodeHash)
+}
@@ -0,0 +1,104 @@
+package hrw
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+func TestHRWMinimalMovementOnRemove(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4"}
+	m1, _ := NewHRW(nodes, routercore.Options{HashSeed: 42})
+	m2, _ := NewHRW(nodes[:3], routercore.Options{HashSeed: 42})
+
+	for i := 0; i < 5000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		before := m1.Pick(key)
+		if before != "n4" && m2.Pick(key) != before {
+			t.Fatalf("key %q moved off surviving node %s", key, before)
+		}
+	}
+}
+
+func TestHRWPickNSpreadsZones(t *testing.T) {
+	nodes := []string{"a1", "a2", "b1", "b2", "c1", "c2"}
+	topo := routercore.Topology{}
+	for _, n := range nodes {
+		topo[n] = routercore.NodeLabels{Zone: "zone-" + n[:1], Host: n}
+	}
+	m, _ := NewHRW(nodes, routercore.Options{
+		HashSeed:      1,
+		Topology:      topo,
+		ReplicaSpread: routercore.DomainZone,
+	})
+	rp := m.(routercore.ReplicaPicker)
+
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		reps := rp.PickN(key, 3)
+		if reps[0] != m.Pick(key) {
+			t.Fatalf("first replica %s is not the primary %s", reps[0], m.Pick(key))
+		}
+		zones := map[string]bool{}
+		for _, r := range reps {
+			zones[topo[r].Zone] = true
+		}
+		if len(zones) != 3 {
+			t.Fatalf("replicas %v for %q share a zone", reps, key)
+		}
+	}
+}
+
+func TestHRWPickNSkipsDrained(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4"}
+	m, _ := NewHRW(nodes, routercore.Options{HashSeed: 42})
+	rp := m.(routercore.ReplicaPicker)
+	m.Drain("n2")
+
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		reps := rp.PickN(key, 3)
+		if len(reps) != 3 || reps[0] != m.Pick(key) {
+			t.Fatalf("unexpected replicas %v for %q (primary %s)", reps, key, m.Pick(key))
+		}
+		for _, r := range reps {
+			if r == "n2" {
+				t.Fatalf("replicas %v for %q include draining node n2", reps, key)
+			}
+		}
+	}
+}
+
+func TestHRWAddLabeled(t *testing.T) {
+	opts := routercore.Options{
+		HashSeed:      1,
+		Topology:      routercore.Topology{"a1": {Zone: "zone-a"}},
+		ReplicaSpread: routercore.DomainZone,
+	}
+	if _, err := NewHRW([]string{"a1", "b1"}, opts); !errors.Is(err, routercore.ErrUnlabeledNode) {
+		t.Fatalf("expected ErrUnlabeledNode for unlabeled b1, got %v", err)
+	}
+	m, err := NewHRW([]string{"a1"}, opts)
+	if err != nil {
+		t.Fatalf("NewHRW: %v", err)
+	}
+	la := m.(routercore.LabeledAdder)
+	if err := la.AddLabeled(routercore.Topology{"b1": {Zone: "zone-b"}}, "b1"); err != nil {
+		t.Fatalf("AddLabeled: %v", err)
+	}
+	rp := m.(routercore.ReplicaPicker)
+	reps := rp.PickN([]byte("key"), 2)
+	if len(reps) != 2 || reps[0][:1] == reps[1][:1] {
+		t.Fatalf("replicas %v share a zone", reps)
+	}
+
+	// plain Add takes an unlabeled node as its own failure domain
+	m.Add("c1")
+	if reps := rp.PickN([]byte("key"), 3); len(reps) != 3 {
+		t.Fatalf("expected 3 replicas after adding unlabeled c1, got %v", reps)
+	}
+	if reps := rp.PickN([]byte("key"), -1); len(reps) != 0 {
+		t.Fatalf("PickN with n = -1 returned %v", reps)
+	}
+}
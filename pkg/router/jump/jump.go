@@ -9,13 +9,27 @@ import (
 
 const MAGIC_NUMBER = 2862933555777941757
 
+// maxRejumps bounds how many times a key is re-hashed away from skipped
+// buckets before falling back to a linear scan.
+const maxRejumps = 32
+
 type mapper struct {
-	mu    sync.RWMutex
-	nodes []string
+	mu     sync.RWMutex
+	nodes  []string
+	hasher hash.Hasher
+
+	drain routercore.DrainSet // draining nodes
 }
 
+// NewJump constructs a Jump mapper. Only opts.HashFunc is used; Jump always
+// hashes keys with seed 0.
 func NewJump(nodes []string, opts routercore.Options) (routercore.Mapper, error) {
-	m := &mapper{}
+	hasher, err := hash.NewHasher(opts.HashFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mapper{hasher: hasher}
 	m.Add(nodes...)
 	return m, nil
 }
@@ -23,7 +37,9 @@ func NewJump(nodes []string, opts routercore.Options) (routercore.Mapper, error)
 func (m *mapper) Add(nodes ...string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.drain.Clear(nodes...)
 	m.nodes = append(m.nodes, nodes...)
+	m.drain.Index(m.nodes, true)
 }
 
 func (m *mapper) Remove(nodes ...string) {
@@ -33,6 +49,7 @@ func (m *mapper) Remove(nodes ...string) {
 		return
 	}
 	rem := make(map[string]struct{})
+	m.drain.Clear(nodes...)
 	for _, n := range nodes {
 		rem[n] = struct{}{}
 	}
@@ -43,21 +60,104 @@ func (m *mapper) Remove(nodes ...string) {
 		}
 	}
 	m.nodes = out
+	m.drain.Index(m.nodes, true)
+}
+
+// Drain keeps the bucket count unchanged and re-hashes keys that land on a
+// draining bucket until they reach a live one, so only the drained node's
+// keys move.
+func (m *mapper) Drain(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.drain.Drain(nodes...)
+	m.drain.Index(m.nodes, true)
 }
 
 func (m *mapper) Pick(key []byte) string {
+	return m.pick(hash.BytesKey(key))
+}
+
+// PickString is Pick for a string key; it does not copy the key.
+func (m *mapper) PickString(key string) string {
+	return m.pick(hash.StringKey(key))
+}
+
+// PickUint64 is Pick for an integer key, hashed as 8 little-endian bytes.
+func (m *mapper) PickUint64(key uint64) string {
+	return m.pick(hash.Uint64Key(key))
+}
+
+func (m *mapper) pick(key hash.Key) string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	return m.nodes[m.pickIndex(key)]
+}
+
+// PickIndex returns the bucket chosen for key, which is also the index
+// of the node in Nodes().
+func (m *mapper) PickIndex(key []byte) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pickIndex(hash.BytesKey(key))
+}
+
+// PickIndexSkipping is like PickIndex but also treats nodes rejected by
+// skip as unavailable. It returns -1 if every node is rejected.
+func (m *mapper) PickIndexSkipping(key hash.Key, skip func(idx int) bool) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pickIndexSkipping(key, m.drain.Skipping(skip))
+}
+
+// Nodes returns a copy of the bucket -> node ID table.
+func (m *mapper) Nodes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]string(nil), m.nodes...)
+}
+
+// pickIndex runs Jump Consistent Hash, avoiding draining buckets; callers
+// must hold m.mu.
+func (m *mapper) pickIndex(key hash.Key) int {
+	return m.pickIndexSkipping(key, m.drain.Skipping(nil))
+}
+
+// pickIndexSkipping returns the Jump bucket for key. If skip rejects it,
+// the key hash is re-mixed and jumped again (spreading the rejected keys
+// evenly), falling back to a linear scan after maxRejumps attempts.
+// Returns -1 if every bucket is rejected; callers must hold m.mu.
+func (m *mapper) pickIndexSkipping(key hash.Key, skip func(idx int) bool) int {
 	if len(m.nodes) == 0 {
 		panic("jump: no nodes registered")
 	}
 
-	// Compute 64-bit hash using our standard xxhash implementation
-	h := hash.XXH64(key, 0) // seed = 0 for Jump (standard practice)
+	// Compute 64-bit hash using the configured hash (xxhash by default)
+	h := m.hasher.Sum64(key, 0) // seed = 0 for Jump (standard practice)
+
+	b := jumpHash(h, len(m.nodes))
+	if skip == nil || !skip(b) {
+		return b
+	}
+	for attempt := uint64(1); attempt <= maxRejumps; attempt++ {
+		if b := jumpHash(remix(h, attempt), len(m.nodes)); !skip(b) {
+			return b
+		}
+	}
+	for i := 1; i < len(m.nodes); i++ {
+		if next := (b + i) % len(m.nodes); !skip(next) {
+			return next
+		}
+	}
+	return -1
+}
 
-	// Jump Consistent Hash algorithm (Google)
-	numBuckets := len(m.nodes)
+// jumpHash is the Jump Consistent Hash algorithm (Google).
+func jumpHash(h uint64, numBuckets int) int {
 	b := -1
 	j := 0
 
@@ -67,5 +167,11 @@ func (m *mapper) Pick(key []byte) string {
 		j = int(float64(b+1) * (float64(1<<31) / float64((h>>33)+1)))
 	}
 
-	return m.nodes[b]
+	return b
+}
+
+// remix derives an independent-looking hash from h for the given retry
+// attempt (a splitmix64 step).
+func remix(h, attempt uint64) uint64 {
+	return hash.Mix64(h + attempt*0x9e3779b97f4a7c15)
 }
@@ -41,3 +41,33 @@ func TestJumpChangesMinimalOnAdd(t *testing.T) {
 		t.Fatalf("too many keys moved: %.2f", ratio)
 	}
 }
+
+func TestJumpPickIndexMatchesPick(t *testing.T) {
+	m, _ := NewJump([]string{"A", "B", "C", "D"}, routercore.Options{})
+	table := m.Nodes()
+
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		if got, want := table[m.PickIndex(key)], m.Pick(key); got != want {
+			t.Fatalf("PickIndex/Pick mismatch for %q: %s vs %s", key, got, want)
+		}
+	}
+}
+
+func TestJumpDrainMovesOnlyDrainedKeys(t *testing.T) {
+	nodes := []string{"A", "B", "C", "D"}
+	ref, _ := NewJump(nodes, routercore.Options{})
+	m, _ := NewJump(nodes, routercore.Options{})
+	m.Drain("D")
+
+	for i := 0; i < 10000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		before, after := ref.Pick(key), m.Pick(key)
+		if after == "D" {
+			t.Fatalf("draining node still picked for %q", key)
+		}
+		if before != "D" && before != after {
+			t.Fatalf("key %q moved off live node %s to %s", key, before, after)
+		}
+	}
+}
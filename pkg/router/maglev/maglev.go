@@ -9,13 +9,20 @@ import (
 
 const defaultTableSize = 65537 // a prime, good default for Maglev
 
+// altSeed derives the second hash stream (permutation skips) from the base
+// seed; an arbitrary odd constant.
+const altSeed = 0x9e3779b97f4a7c15
+
 // mapper implements routercore.Mapper using the Maglev algorithm.
 type mapper struct {
-	mu    sync.RWMutex
-	nodes []string // node IDs, indexable by table entries
-	table []int    // slot -> node index
-	m     int      // table size
-	seed  uint64   // base seed for hashing
+	mu     sync.RWMutex
+	nodes  []string // node IDs, indexable by table entries
+	table  []int    // slot -> node index
+	m      int      // table size
+	seed   uint64   // base seed for hashing
+	hasher hash.Hasher
+
+	drain routercore.DrainSet // draining nodes
 }
 
 // NewMaglev constructs a new Maglev mapper.
@@ -23,8 +30,14 @@ type mapper struct {
 // opts.TableSize controls M (table size). If zero or negative, a sensible
 // default (defaultTableSize) is chosen. opts.HashSeed controls hashing.
 func NewMaglev(nodes []string, opts routercore.Options) (routercore.Mapper, error) {
+	hasher, err := hash.NewHasher(opts.HashFunc)
+	if err != nil {
+		return nil, err
+	}
+
 	m := &mapper{
-		seed: opts.HashSeed,
+		seed:   opts.HashSeed,
+		hasher: hasher,
 	}
 
 	if opts.TableSize > 0 {
@@ -41,6 +54,7 @@ func NewMaglev(nodes []string, opts routercore.Options) (routercore.Mapper, erro
 func (m *mapper) Add(nodes ...string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.drain.Clear(nodes...)
 	m.rebuild(append(m.nodes, nodes...))
 }
 
@@ -52,6 +66,7 @@ func (m *mapper) Remove(nodes ...string) {
 		return
 	}
 	removeSet := make(map[string]struct{}, len(nodes))
+	m.drain.Clear(nodes...)
 	for _, n := range nodes {
 		removeSet[n] = struct{}{}
 	}
@@ -66,11 +81,93 @@ func (m *mapper) Remove(nodes ...string) {
 	m.rebuild(kept)
 }
 
+// Drain leaves the lookup table untouched and sends keys whose slot belongs
+// to a draining node along their probe sequence to the first slot owned by
+// a non-draining node, so only the drained node's keys move.
+func (m *mapper) Drain(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.drain.Drain(nodes...)
+	m.drain.Index(m.nodes, true)
+}
+
 // Pick selects a node for the given key by hashing into the Maglev table.
 func (m *mapper) Pick(key []byte) string {
+	return m.pick(hash.BytesKey(key))
+}
+
+// PickString is Pick for a string key; it does not copy the key.
+func (m *mapper) PickString(key string) string {
+	return m.pick(hash.StringKey(key))
+}
+
+// PickUint64 is Pick for an integer key, hashed as 8 little-endian bytes.
+func (m *mapper) PickUint64(key uint64) string {
+	return m.pick(hash.Uint64Key(key))
+}
+
+func (m *mapper) pick(key hash.Key) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.nodes[m.pickIndex(key)]
+}
+
+// PickIndex returns the table entry for key, i.e. the node's index in Nodes().
+func (m *mapper) PickIndex(key []byte) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pickIndex(hash.BytesKey(key))
+}
+
+// PickIndexSkipping is like PickIndex but also treats nodes rejected by
+// skip as unavailable. It returns -1 if every node is rejected.
+func (m *mapper) PickIndexSkipping(key hash.Key, skip func(idx int) bool) int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	return m.pickIndexSkipping(key, m.drain.Skipping(skip))
+}
+
+// Nodes returns a copy of the deduplicated node table.
+func (m *mapper) Nodes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]string(nil), m.nodes...)
+}
+
+// Slots returns a copy of the lookup table (slot -> node index).
+func (m *mapper) Slots() []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]int(nil), m.table...)
+}
+
+// Slot returns the table slot key hashes to, before any draining node is
+// skipped.
+func (m *mapper) Slot(key hash.Key) int {
+	return int(m.hasher.Sum64(key, m.seed) % uint64(m.m))
+}
+
+// pickIndex looks key up in the Maglev table, skipping slots owned by
+// draining nodes; callers must hold m.mu.
+func (m *mapper) pickIndex(key hash.Key) int {
+	return m.pickIndexSkipping(key, m.drain.Skipping(nil))
+}
+
+// pickIndexSkipping returns the owner of key's slot. If skip rejects it,
+// the key walks its own permutation of the table (offset = its slot, skip
+// from the second hash stream, as nodes do when filling the table), so a
+// rejected node's keys spread over all other nodes in proportion to their
+// slots instead of piling onto the owners of the neighbouring slots. With
+// a table size that is not prime the permutation may not cover the table,
+// so a linear scan follows. It returns -1 if every node is rejected;
+// callers must hold m.mu.
+func (m *mapper) pickIndexSkipping(key hash.Key, skip func(idx int) bool) int {
 	if len(m.nodes) == 0 {
 		panic("maglev: no nodes registered")
 	}
@@ -78,15 +175,34 @@ func (m *mapper) Pick(key []byte) string {
 		panic("maglev: table not initialized")
 	}
 
-	h := hash.XXH64(key, m.seed)
-	slot := int(h % uint64(m.m))
+	slot := m.Slot(key)
 	nodeIdx := m.table[slot]
 
 	if nodeIdx < 0 || nodeIdx >= len(m.nodes) {
 		panic("maglev: invalid table entry; rebuild required")
 	}
+	if skip == nil || !skip(nodeIdx) {
+		return nodeIdx
+	}
 
-	return m.nodes[nodeIdx]
+	if m.m > 1 {
+		step := int(m.hasher.Sum64(key, m.seed^altSeed)%uint64(m.m-1)) + 1
+		pos := slot
+		for i := 1; i < m.m; i++ {
+			if pos += step; pos >= m.m {
+				pos -= m.m
+			}
+			if nodeIdx := m.table[pos]; !skip(nodeIdx) {
+				return nodeIdx
+			}
+		}
+	}
+	for i := 1; i < m.m; i++ {
+		if nodeIdx := m.table[(slot+i)%m.m]; !skip(nodeIdx) {
+			return nodeIdx
+		}
+	}
+	return -1
 }
 
 // rebuild rebuilds the Maglev lookup table for the given node list.
@@ -94,6 +210,8 @@ func (m *mapper) Pick(key []byte) string {
 // It deduplicates nodes, computes per-node permutations, and fills
 // the table so that each slot maps to exactly one node index.
 func (m *mapper) rebuild(nodes []string) {
+	defer func() { m.drain.Index(m.nodes, true) }()
+
 	// deduplicate nodes while preserving order
 	seen := make(map[string]struct{}, len(nodes))
 	var uniq []string
@@ -128,13 +246,11 @@ func (m *mapper) rebuild(nodes []string) {
 
 	// Compute offset and skip per node using two hash streams.
 	// We derive them from the same base seed with different mixes.
-	const altSeed = 0x9e3779b97f4a7c15 // arbitrary odd constant for variation
-
 	for i, id := range m.nodes {
 		// h1 chooses starting offset
-		h1 := hash.XXH64String(id, m.seed)
+		h1 := m.hasher.Sum64(hash.StringKey(id), m.seed)
 		// h2 chooses skip; ensure 1 <= skip <= M-1
-		h2 := hash.XXH64String(id, m.seed^altSeed)
+		h2 := m.hasher.Sum64(hash.StringKey(id), m.seed^altSeed)
 
 		offset := int(h1 % uint64(M))
 		skip := int(h2%(uint64(M-1))) + 1
@@ -1,8 +1,10 @@
 package maglev
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
 	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
 )
 
@@ -55,3 +57,105 @@ func TestMaglevUsesAllNodes(t *testing.T) {
 		}
 	}
 }
+
+func TestMaglevPickIndexMatchesPick(t *testing.T) {
+	m, _ := NewMaglev([]string{"n1", "n2", "n3", "n2"}, routercore.Options{
+		TableSize: 1021,
+		HashSeed:  7,
+	})
+	table := m.Nodes()
+	if len(table) != 3 {
+		t.Fatalf("expected deduplicated table of 3 nodes, got %v", table)
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		if got, want := table[m.PickIndex(key)], m.Pick(key); got != want {
+			t.Fatalf("PickIndex/Pick mismatch for %q: %s vs %s", key, got, want)
+		}
+	}
+}
+
+func TestMaglevDrainMovesOnlyDrainedKeys(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4", "n5"}
+	opts := routercore.Options{TableSize: 65537, HashSeed: 1}
+	ref, _ := NewMaglev(nodes, opts)
+	m, _ := NewMaglev(nodes, opts)
+	m.Drain("n3")
+
+	for i := 0; i < 10000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		before, after := ref.Pick(key), m.Pick(key)
+		if after == "n3" {
+			t.Fatalf("draining node still picked for %q", key)
+		}
+		if before != "n3" && before != after {
+			t.Fatalf("key %q moved off live node %s to %s", key, before, after)
+		}
+	}
+
+	m.Add("n3")
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		if ref.Pick(key) != m.Pick(key) {
+			t.Fatalf("re-adding drained node did not restore mapping for %q", key)
+		}
+	}
+}
+
+func TestMaglevSlotsMatchLookup(t *testing.T) {
+	m, _ := NewMaglev([]string{"n1", "n2", "n3"}, routercore.Options{HashSeed: 42, TableSize: 101})
+	st := m.(routercore.SlotTable)
+	slots := st.Slots()
+	if len(slots) != 101 {
+		t.Fatalf("expected 101 slots, got %d", len(slots))
+	}
+	owned := make([]int, 3)
+	for _, idx := range slots {
+		owned[idx]++
+	}
+	for i, n := range owned {
+		// Maglev gives every node M/N slots, give or take one
+		if n < 33 || n > 34 {
+			t.Fatalf("node %d owns %d of 101 slots", i, n)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := []byte{byte(i), byte(i >> 8)}
+		if got, want := m.PickIndex(key), slots[st.Slot(hash.BytesKey(key))]; got != want {
+			t.Fatalf("key %v: PickIndex %d, slot owner %d", key, got, want)
+		}
+	}
+}
+
+func TestMaglevDrainSpreadsKeysOverAllNodes(t *testing.T) {
+	nodes := make([]string, 10)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("n%d", i)
+	}
+	opts := routercore.Options{TableSize: 65537, HashSeed: 1}
+	ref, _ := NewMaglev(nodes, opts)
+	m, _ := NewMaglev(nodes, opts)
+	m.Drain("n3")
+
+	moved := map[string]int{}
+	total := 0
+	for i := 0; i < 200000; i++ {
+		key := []byte(fmt.Sprintf("k-%d", i))
+		if ref.Pick(key) == "n3" {
+			moved[m.Pick(key)]++
+			total++
+		}
+	}
+	// the drained node's keys go to every other node about equally
+	mean := float64(total) / float64(len(nodes)-1)
+	for _, n := range nodes {
+		if n == "n3" {
+			continue
+		}
+		if got := float64(moved[n]); got < 0.85*mean || got > 1.15*mean {
+			t.Fatalf("%s took %d of %d moved keys (mean %.0f): %v", n, moved[n], total, mean, moved)
+		}
+	}
+}
@@ -22,22 +22,62 @@ type mapper struct {
 
 	vnodes   int
 	hashSeed uint64
+	hasher   hash.Hasher
+
+	// replica placement
+	topology routercore.Topology
+	spread   routercore.Domain
+
+	drain routercore.DrainSet // draining nodes
 }
 
 // NewRingCH constructs a basic CH router.
 func NewRingCH(nodes []string, opts routercore.Options) (routercore.Mapper, error) {
+	hasher, err := hash.NewHasher(opts.HashFunc)
+	if err != nil {
+		return nil, err
+	}
+
 	m := &mapper{
+		hasher:   hasher,
 		vnodes:   defaultOrInt(opts.Vnodes, defaultVnodes),
 		hashSeed: opts.HashSeed,
+		topology: opts.Topology,
+		spread:   opts.ReplicaSpread,
+	}
+	if err := m.topology.Validate(nodes, m.spread); err != nil {
+		return nil, err
 	}
 	m.rebuild(nodes)
 	return m, nil
 }
 
-// Add adds new nodes and rebuilds ring.
+// Add adds new nodes and rebuilds ring. Re-added nodes stop draining. A
+// node with no label at the ReplicaSpread level is its own failure domain
+// (see Topology.DomainOf); use AddLabeled to label new nodes.
 func (m *mapper) Add(nodes ...string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.add(nodes)
+}
+
+// AddLabeled records labels for nodes and adds them (see
+// routercore.LabeledAdder).
+func (m *mapper) AddLabeled(labels routercore.Topology, nodes ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	topo := m.topology.Merge(labels)
+	if err := topo.Validate(nodes, m.spread); err != nil {
+		return err
+	}
+	m.topology = topo
+	m.add(nodes)
+	return nil
+}
+
+// add adds nodes; callers must hold m.mu.
+func (m *mapper) add(nodes []string) {
+	m.drain.Clear(nodes...)
 	m.rebuild(append(m.nodes, nodes...))
 }
 
@@ -47,6 +87,7 @@ func (m *mapper) Remove(nodes ...string) {
 	defer m.mu.Unlock()
 
 	removeSet := make(map[string]struct{}, len(nodes))
+	m.drain.Clear(nodes...)
 	for _, n := range nodes {
 		removeSet[n] = struct{}{}
 	}
@@ -60,7 +101,19 @@ func (m *mapper) Remove(nodes ...string) {
 	m.rebuild(kept)
 }
 
+// Drain keeps nodes on the ring but sends their keys to the next
+// non-draining successor. The ring itself is not rebuilt.
+func (m *mapper) Drain(nodes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.drain.Drain(nodes...)
+	m.drain.Index(m.nodes, true)
+}
+
 func (m *mapper) rebuild(nodes []string) {
+	defer func() { m.drain.Index(m.nodes, true) }()
+
 	if len(nodes) == 0 {
 		m.nodes = nil
 		m.rng = nil
@@ -80,13 +133,113 @@ func (m *mapper) rebuild(nodes []string) {
 	m.nodes = uniq
 
 	// Build ring
-	m.rng = ring.New(m.nodes, m.vnodes, m.hashSeed)
+	m.rng = ring.NewWithHash(m.nodes, m.vnodes, m.hashSeed, m.hasher.Func())
 }
 
 func (m *mapper) Pick(key []byte) string {
+	return m.pick(hash.BytesKey(key))
+}
+
+// PickString is Pick for a string key; it does not copy the key.
+func (m *mapper) PickString(key string) string {
+	return m.pick(hash.StringKey(key))
+}
+
+// PickUint64 is Pick for an integer key, hashed as 8 little-endian bytes.
+func (m *mapper) PickUint64(key uint64) string {
+	return m.pick(hash.Uint64Key(key))
+}
+
+func (m *mapper) pick(key hash.Key) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.nodes[m.pickIndex(key)]
+}
+
+// PickIndex returns the index in Nodes() of the ring successor of key.
+func (m *mapper) PickIndex(key []byte) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pickIndex(hash.BytesKey(key))
+}
+
+// PickIndexSkipping is like PickIndex but also treats nodes rejected by
+// skip as unavailable. It returns -1 if every node is rejected.
+func (m *mapper) PickIndexSkipping(key hash.Key, skip func(idx int) bool) int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	return m.pickIndexSkipping(key, m.drain.Skipping(skip))
+}
+
+// Nodes returns a copy of the deduplicated node table.
+func (m *mapper) Nodes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]string(nil), m.nodes...)
+}
+
+// Tokens returns the ring's vnode tokens sorted by hash.
+func (m *mapper) Tokens() []routercore.Token {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.rng.ExportTokens()
+}
+
+// RingHash returns the ring position at which key's lookup starts.
+func (m *mapper) RingHash(key hash.Key) uint64 {
+	return m.hasher.Sum64(key, m.hashSeed)
+}
+
+// PickN returns up to n distinct nodes for key, taken in order while walking
+// the ring clockwise from the key's successor and passing over draining
+// nodes, so the first entry is the node Pick returns. With a ReplicaSpread
+// level set, nodes in an already-used failure domain are skipped while
+// unused domains remain.
+func (m *mapper) PickN(key []byte, n int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.nodes) == 0 || m.rng == nil {
+		panic("ringch: no nodes registered")
+	}
+
+	want := n
+	if m.spread != routercore.DomainNone {
+		// we may need to look past n nodes to find distinct domains
+		want = len(m.nodes)
+	}
+
+	h := m.hasher.Sum64(hash.BytesKey(key), m.hashSeed)
+	start := m.rng.SuccessorIndex(h)
+	skip := m.drain.Skipping(nil)
+	seen := make([]bool, len(m.nodes))
+	var candidates []string
+	for i := 0; i < len(m.rng.Tokens) && len(candidates) < want; i++ {
+		nodeIdx := m.rng.Tokens[(start+i)%len(m.rng.Tokens)].NodeIdx
+		if seen[nodeIdx] || skip != nil && skip(nodeIdx) {
+			continue
+		}
+		seen[nodeIdx] = true
+		candidates = append(candidates, m.nodes[nodeIdx])
+	}
+	return routercore.SpreadReplicas(candidates, n, m.topology, m.spread)
+}
+
+// pickIndex walks to the first non-draining ring successor; callers must
+// hold m.mu.
+func (m *mapper) pickIndex(key hash.Key) int {
+	return m.pickIndexSkipping(key, m.drain.Skipping(nil))
+}
+
+// pickIndexSkipping returns the first ring successor of key whose node
+// index is not rejected by skip, or -1 if every node is rejected. A nil
+// skip accepts the immediate successor; callers must hold m.mu.
+func (m *mapper) pickIndexSkipping(key hash.Key, skip func(idx int) bool) int {
 	if len(m.nodes) == 0 {
 		panic("ringch: no nodes registered")
 	}
@@ -94,9 +247,18 @@ func (m *mapper) Pick(key []byte) string {
 		panic("ringch: ring not initialized")
 	}
 
-	h := hash.XXH64(key, m.hashSeed)
+	h := m.hasher.Sum64(key, m.hashSeed)
 	idx := m.rng.SuccessorIndex(h)
-	return m.nodes[m.rng.Tokens[idx].NodeIdx]
+	if skip == nil {
+		return m.rng.Tokens[idx].NodeIdx
+	}
+	for i := 0; i < len(m.rng.Tokens); i++ {
+		nodeIdx := m.rng.Tokens[(idx+i)%len(m.rng.Tokens)].NodeIdx
+		if !skip(nodeIdx) {
+			return nodeIdx
+		}
+	}
+	return -1
 }
 
 func defaultOrInt(v, def int) int {
@@ -1,8 +1,10 @@
 package ringch
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
 	rc "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
 )
 
@@ -22,3 +24,165 @@ func TestRingCHDeterministic(t *testing.T) {
 		t.Fatalf("expected deterministic mapping, got %s vs %s", r1, r2)
 	}
 }
+
+func TestRingCHPickIndexMatchesPick(t *testing.T) {
+	m, _ := NewRingCH([]string{"n1", "n2", "n3"}, rc.Options{HashSeed: 42, Vnodes: 50})
+	table := m.Nodes()
+
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		if got, want := table[m.PickIndex(key)], m.Pick(key); got != want {
+			t.Fatalf("PickIndex/Pick mismatch for %q: %s vs %s", key, got, want)
+		}
+	}
+}
+
+func TestRingCHPickNSpreadsZones(t *testing.T) {
+	nodes := []string{"a1", "a2", "a3", "b1", "b2", "b3"}
+	topo := rc.Topology{}
+	for _, n := range nodes {
+		topo[n] = rc.NodeLabels{Zone: "zone-" + n[:1]}
+	}
+	m, _ := NewRingCH(nodes, rc.Options{
+		HashSeed:      42,
+		Vnodes:        50,
+		Topology:      topo,
+		ReplicaSpread: rc.DomainZone,
+	})
+	rp := m.(rc.ReplicaPicker)
+
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		reps := rp.PickN(key, 3)
+		if len(reps) != 3 || reps[0] != m.Pick(key) {
+			t.Fatalf("unexpected replicas %v for %q (primary %s)", reps, key, m.Pick(key))
+		}
+		// only two zones exist: the first two replicas must differ
+		if topo[reps[0]].Zone == topo[reps[1]].Zone {
+			t.Fatalf("first two replicas %v share a zone", reps)
+		}
+	}
+}
+
+func TestRingCHPickNSkipsDrained(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4"}
+	m, _ := NewRingCH(nodes, rc.Options{HashSeed: 42, Vnodes: 50})
+	rp := m.(rc.ReplicaPicker)
+	m.Drain("n2")
+
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		reps := rp.PickN(key, 3)
+		if len(reps) != 3 || reps[0] != m.Pick(key) {
+			t.Fatalf("unexpected replicas %v for %q (primary %s)", reps, key, m.Pick(key))
+		}
+		for _, r := range reps {
+			if r == "n2" {
+				t.Fatalf("replicas %v for %q include draining node n2", reps, key)
+			}
+		}
+	}
+}
+
+func TestRingCHAddLabeled(t *testing.T) {
+	topo := rc.Topology{"a1": {Zone: "zone-a"}, "b1": {Zone: "zone-b"}}
+	opts := rc.Options{HashSeed: 42, Vnodes: 50, Topology: topo, ReplicaSpread: rc.DomainZone}
+	if _, err := NewRingCH([]string{"a1", "b1", "c1"}, opts); !errors.Is(err, rc.ErrUnlabeledNode) {
+		t.Fatalf("expected ErrUnlabeledNode for unlabeled c1, got %v", err)
+	}
+
+	m, err := NewRingCH([]string{"a1", "b1"}, opts)
+	if err != nil {
+		t.Fatalf("failed to create ringch mapper: %v", err)
+	}
+	la := m.(rc.LabeledAdder)
+	if err := la.AddLabeled(nil, "c1"); !errors.Is(err, rc.ErrUnlabeledNode) {
+		t.Fatalf("expected ErrUnlabeledNode adding c1 without labels, got %v", err)
+	}
+	if len(m.Nodes()) != 2 {
+		t.Fatalf("failed AddLabeled added nodes: %v", m.Nodes())
+	}
+	if err := la.AddLabeled(rc.Topology{"c1": {Zone: "zone-c"}}, "c1"); err != nil {
+		t.Fatalf("AddLabeled: %v", err)
+	}
+	if _, ok := topo["c1"]; ok {
+		t.Fatalf("AddLabeled modified the caller's topology")
+	}
+
+	rp := m.(rc.ReplicaPicker)
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		zones := map[string]bool{}
+		for _, r := range rp.PickN(key, 3) {
+			zones[r[:1]] = true
+		}
+		if len(zones) != 3 {
+			t.Fatalf("replicas for %q share a zone", key)
+		}
+	}
+
+	// plain Add takes an unlabeled node as its own failure domain
+	m.Add("d1")
+	if len(m.Nodes()) != 4 {
+		t.Fatalf("Add of unlabeled d1 left nodes %v", m.Nodes())
+	}
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		zones := map[string]bool{}
+		for _, r := range rp.PickN(key, 4) {
+			zones[r[:1]] = true
+		}
+		if len(zones) != 4 {
+			t.Fatalf("replicas for %q share a domain", key)
+		}
+	}
+	if reps := rp.PickN([]byte("key"), -1); len(reps) != 0 {
+		t.Fatalf("PickN with n = -1 returned %v", reps)
+	}
+}
+
+func TestRingCHHashFunc(t *testing.T) {
+	if _, err := NewRingCH([]string{"n1"}, rc.Options{HashFunc: "nope"}); err == nil {
+		t.Fatalf("expected error for unknown hash function")
+	}
+
+	nodes := []string{"n1", "n2", "n3"}
+	a, _ := NewRingCH(nodes, rc.Options{HashSeed: 42, HashFunc: "murmur3"})
+	b, _ := NewRingCH(nodes, rc.Options{HashSeed: 42, HashFunc: "murmur3"})
+	for i := 0; i < 100; i++ {
+		key := []byte("k-" + string(rune(i)))
+		if a.Pick(key) != b.Pick(key) {
+			t.Fatalf("expected deterministic mapping with murmur3 for %q", key)
+		}
+	}
+}
+
+func TestRingCHTokensMatchLookup(t *testing.T) {
+	m, _ := NewRingCH([]string{"n1", "n2", "n3"}, rc.Options{HashSeed: 42, Vnodes: 50})
+	tr := m.(rc.TokenRing)
+	tokens := tr.Tokens()
+	if len(tokens) != 3*50 {
+		t.Fatalf("expected 150 tokens, got %d", len(tokens))
+	}
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i-1].Hash > tokens[i].Hash {
+			t.Fatalf("tokens not sorted at %d", i)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := []byte("k-" + string(rune(i)))
+		h := tr.RingHash(hash.BytesKey(key))
+		// the owner is the first token at or after h, wrapping to the start
+		owner := tokens[0].NodeIdx
+		for _, tok := range tokens {
+			if tok.Hash >= h {
+				owner = tok.NodeIdx
+				break
+			}
+		}
+		if got := m.PickIndex(key); got != owner {
+			t.Fatalf("key %q: PickIndex %d, successor token owner %d", key, got, owner)
+		}
+	}
+}
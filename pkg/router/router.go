@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	chbl "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router/chbl"
+	hrw "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router/hrw"
 	jump "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router/jump"
 	maglev "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router/maglev"
 	ringch "github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/router/ringch"
@@ -28,49 +29,48 @@ type Mapper interface {
 	// Removing a node that does not exist MUST be safe (no-op).
 	Remove(nodes ...string)
 
+	// Drain stops new keys from landing on the given nodes without
+	// removing them. Keys go to the next candidate instead (ring
+	// successor, next Maglev slot, next HRW rank); CH-BL treats a
+	// draining node as having zero capacity. Add clears the state.
+	Drain(nodes ...string)
+
 	// Pick returns the node chosen for the given key.
 	//
 	// Implementations may panic if there are zero nodes;
 	// the caller is responsible for ensuring the node set
 	// is non-empty before calling Pick.
 	Pick(key []byte) string
+
+	// PickString and PickUint64 are allocation-free variants of Pick for
+	// string and integer keys. They return the same node as Pick on the
+	// equivalent bytes; uint64 keys are encoded as 8 little-endian bytes.
+	PickString(key string) string
+	PickUint64(key uint64) string
+
+	// PickIndex returns the ordinal of the chosen node in Nodes(),
+	// or -1 if no node could be chosen (e.g. CH-BL with every node full).
+	PickIndex(key []byte) int
+
+	// Nodes returns a copy of the index -> node ID table used by PickIndex.
+	// Indices stay valid until the next Add or Remove.
+	Nodes() []string
 }
 
-// Algo is an enum-like type for supported algorithms.
-type Algo string
+// Algo is routercore.Algo, so the constants below can be passed to New.
+type Algo = routercore.Algo
 
 const (
 	AlgoJump   Algo = "jump"   // Jump consistent hashing (baseline)
 	AlgoMaglev Algo = "maglev" // Maglev permutation table
 	AlgoCHBL   Algo = "chbl"   // Consistent Hashing with Bounded Loads
+	AlgoRing   Algo = "ring"   // Plain vnode ring consistent hashing
+	AlgoHRW    Algo = "hrw"    // Rendezvous (highest random weight) hashing
 )
 
-// Options configures algorithm-specific parameters and shared parameters.
-//
-// Not all fields are used by all algorithms; unused fields are ignored.
-type Options struct {
-	// TableSize is the Maglev lookup table size (M).
-	// If zero, the Maglev implementation should pick a sensible default.
-	TableSize int
-
-	// LoadFactor is the "c" parameter for CH-BL. It bounds the maximum
-	// per-node load to at most c * (total_keys / num_nodes).
-	// Typical values are in [1.1, 1.5].
-	LoadFactor float64
-
-	// Vnodes is the number of virtual nodes per physical node for CH-BL.
-	// More vnodes -> smoother distribution but more memory and rebuild cost.
-	Vnodes int
-
-	// WalkThreshold is the number of linear steps CH-BL will take on the
-	// ring before invoking the two-choice fallback to avoid long walks.
-	WalkThreshold int
-
-	// HashSeed is a shared seed for the hash function. Using a fixed seed
-	// makes the mapping deterministic across processes for the same
-	// node set and keys, which is important for reproducible experiments.
-	HashSeed uint64
-}
+// Options is routercore.Options; see there for the fields. Not all fields
+// are used by all algorithms; unused fields are ignored.
+type Options = routercore.Options
 
 // ErrUnknownAlgo is returned by New when the requested Algo is not supported.
 var ErrUnknownAlgo = errors.New("router: unknown algorithm")
@@ -89,6 +89,8 @@ func New(algo routercore.Algo, opts routercore.Options, nodes []string) (routerc
 		return chbl.NewCHBL(nodes, opts)
 	case routercore.AlgoRing:
 		return ringch.NewRingCH(nodes, opts)
+	case routercore.AlgoHRW:
+		return hrw.NewHRW(nodes, opts)
 	default:
 		return nil, routercore.ErrUnknownAlgo
 	}
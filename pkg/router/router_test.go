@@ -0,0 +1,62 @@
+package router
+
+import (
+	"encoding/binary"
+	"strconv"
+	"testing"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/routercore"
+)
+
+var allAlgos = []routercore.Algo{
+	routercore.AlgoJump,
+	routercore.AlgoMaglev,
+	routercore.AlgoCHBL,
+	routercore.AlgoRing,
+	routercore.AlgoHRW,
+}
+
+func newTestMapper(t *testing.T, algo routercore.Algo) routercore.Mapper {
+	t.Helper()
+	nodes := []string{"n1", "n2", "n3", "n4", "n5"}
+	m, err := New(algo, routercore.Options{HashSeed: 7, ExpectedKeys: 10000}, nodes)
+	if err != nil {
+		t.Fatalf("New(%s): %v", algo, err)
+	}
+	return m
+}
+
+func TestTypedKeysMatchBytes(t *testing.T) {
+	for _, algo := range allAlgos {
+		// separate mappers so CH-BL load evolves identically on both paths
+		byBytes, byString := newTestMapper(t, algo), newTestMapper(t, algo)
+		for i := 0; i < 2000; i++ {
+			s := "key-" + strconv.Itoa(i)
+			if a, b := byBytes.Pick([]byte(s)), byString.PickString(s); a != b {
+				t.Fatalf("%s: Pick(%q)=%s but PickString=%s", algo, s, a, b)
+			}
+		}
+
+		byBytes, byUint := newTestMapper(t, algo), newTestMapper(t, algo)
+		var buf [8]byte
+		for i := uint64(0); i < 2000; i++ {
+			v := i * 0x9e3779b97f4a7c15
+			binary.LittleEndian.PutUint64(buf[:], v)
+			if a, b := byBytes.Pick(buf[:]), byUint.PickUint64(v); a != b {
+				t.Fatalf("%s: Pick(%d)=%s but PickUint64=%s", algo, v, a, b)
+			}
+		}
+	}
+}
+
+func TestTypedKeysNoAllocs(t *testing.T) {
+	for _, algo := range allAlgos {
+		m := newTestMapper(t, algo)
+		if n := testing.AllocsPerRun(200, func() { m.PickString("user-42") }); n != 0 {
+			t.Fatalf("%s: PickString allocated %.1f times", algo, n)
+		}
+		if n := testing.AllocsPerRun(200, func() { m.PickUint64(42) }); n != 0 {
+			t.Fatalf("%s: PickUint64 allocated %.1f times", algo, n)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package routercore
+
+// DrainSet is the draining state the mappers share: the draining node IDs,
+// and the same set indexed like the mapper's node table. The zero value is
+// empty. It has no lock of its own; mappers guard it with theirs.
+type DrainSet struct {
+	ids   map[string]struct{}
+	flags []bool // node index -> draining; nil if none
+}
+
+// Drain marks nodes as draining. Call Index afterwards.
+func (d *DrainSet) Drain(nodes ...string) {
+	if d.ids == nil {
+		d.ids = make(map[string]struct{}, len(nodes))
+	}
+	for _, n := range nodes {
+		d.ids[n] = struct{}{}
+	}
+}
+
+// Clear drops the draining state of nodes, as Add and Remove do. Call
+// Index afterwards.
+func (d *DrainSet) Clear(nodes ...string) {
+	for _, n := range nodes {
+		delete(d.ids, n)
+	}
+}
+
+// Index recomputes the per-index flags for the node table nodes. With
+// ignoreAll the flags are left nil when every node is draining, for
+// mappers that then ignore the drain state.
+func (d *DrainSet) Index(nodes []string, ignoreAll bool) {
+	d.flags = nil
+	count := 0
+	for i, n := range nodes {
+		if _, ok := d.ids[n]; !ok {
+			continue
+		}
+		if d.flags == nil {
+			d.flags = make([]bool, len(nodes))
+		}
+		d.flags[i] = true
+		count++
+	}
+	if ignoreAll && count == len(nodes) {
+		d.flags = nil
+	}
+}
+
+// Drained reports whether node index idx is draining.
+func (d *DrainSet) Drained(idx int) bool {
+	return d.flags != nil && d.flags[idx]
+}
+
+// Skipping returns skip extended to also reject draining nodes; it is nil
+// if skip is nil and no node is draining.
+func (d *DrainSet) Skipping(skip func(idx int) bool) func(idx int) bool {
+	switch {
+	case d.flags == nil:
+		return skip
+	case skip == nil:
+		return d.Drained
+	}
+	return func(idx int) bool {
+		return d.flags[idx] || skip(idx)
+	}
+}
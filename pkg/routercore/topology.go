@@ -0,0 +1,139 @@
+package routercore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Domain names a failure-domain level used to spread replicas.
+type Domain string
+
+const (
+	DomainNone Domain = ""
+	DomainZone Domain = "zone"
+	DomainRack Domain = "rack"
+	DomainHost Domain = "host"
+)
+
+// NodeLabels carries placement metadata for a node.
+type NodeLabels struct {
+	Zone string
+	Rack string
+	Host string
+}
+
+// Get returns the label value for the given domain level, or "" if unset.
+func (l NodeLabels) Get(d Domain) string {
+	switch d {
+	case DomainZone:
+		return l.Zone
+	case DomainRack:
+		return l.Rack
+	case DomainHost:
+		return l.Host
+	default:
+		return ""
+	}
+}
+
+// Topology maps node IDs to their labels. Nodes missing from the map are
+// treated as their own failure domain by DomainOf; mapper constructors and
+// AddLabeled reject them when replicas are spread (see Validate).
+type Topology map[string]NodeLabels
+
+// ErrUnlabeledNode is returned when replicas are spread across a domain
+// level and a node has no label at that level.
+var ErrUnlabeledNode = errors.New("routercore: node has no label at the replica spread level")
+
+// Validate checks that every node has a label at level d, so replicas can
+// be spread across it. Any topology is valid for DomainNone.
+func (t Topology) Validate(nodes []string, d Domain) error {
+	if d == DomainNone {
+		return nil
+	}
+	for _, n := range nodes {
+		if t[n].Get(d) == "" {
+			return fmt.Errorf("%w: %s has no %s label", ErrUnlabeledNode, n, d)
+		}
+	}
+	return nil
+}
+
+// Merge returns a copy of t with the entries of labels added; labels win
+// for nodes present in both. Neither map is modified.
+func (t Topology) Merge(labels Topology) Topology {
+	out := make(Topology, len(t)+len(labels))
+	for n, l := range t {
+		out[n] = l
+	}
+	for n, l := range labels {
+		out[n] = l
+	}
+	return out
+}
+
+// DomainOf returns the failure domain of node at level d. Unlabeled nodes
+// (or d == DomainNone) fall back to the node ID so they never collide.
+func (t Topology) DomainOf(node string, d Domain) string {
+	if d == DomainNone {
+		return node
+	}
+	if v := t[node].Get(d); v != "" {
+		return v
+	}
+	return node
+}
+
+// LabeledAdder is implemented by mappers that spread replicas across
+// failure domains (ring, HRW). AddLabeled is Add for nodes whose labels
+// were not in Options.Topology: it records labels and then adds nodes. It
+// returns an error, adding nothing, if a ReplicaSpread level is set and a
+// node has no label at that level; plain Add accepts such a node as its
+// own failure domain.
+type LabeledAdder interface {
+	AddLabeled(labels Topology, nodes ...string) error
+}
+
+// ReplicaPicker is implemented by mappers that can return an ordered
+// replica set for a key (the first entry is the primary).
+type ReplicaPicker interface {
+	PickN(key []byte, n int) []string
+}
+
+// SpreadReplicas picks up to n distinct nodes from candidates, which must be
+// in preference order. Nodes in a failure domain not yet used are taken
+// first; if there are fewer domains than n, the remaining slots are filled
+// with the best leftover candidates.
+func SpreadReplicas(candidates []string, n int, topo Topology, d Domain) []string {
+	if n <= 0 {
+		return []string{}
+	}
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	out := make([]string, 0, n)
+	taken := make([]bool, len(candidates))
+	usedDomains := make(map[string]struct{}, n)
+
+	for i, c := range candidates {
+		if len(out) == n {
+			return out
+		}
+		dom := topo.DomainOf(c, d)
+		if _, used := usedDomains[dom]; used {
+			continue
+		}
+		usedDomains[dom] = struct{}{}
+		taken[i] = true
+		out = append(out, c)
+	}
+	for i, c := range candidates {
+		if len(out) == n {
+			break
+		}
+		if !taken[i] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
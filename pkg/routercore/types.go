@@ -1,11 +1,113 @@
 package routercore
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/bhusalashish/consistent-hashing-bounded-loads.git/pkg/hash"
+)
 
 type Mapper interface {
 	Add(nodes ...string)
 	Remove(nodes ...string)
 	Pick(key []byte) string
+
+	// PickString and PickUint64 are allocation-free variants of Pick for
+	// string and integer keys. They choose the same node as Pick on the
+	// key's bytes (uint64 keys are encoded as 8 little-endian bytes).
+	PickString(key string) string
+	PickUint64(key uint64) string
+
+	// Drain marks nodes as draining: they keep their membership (and, for
+	// CH-BL, their existing load) but receive no new keys. Keys that would
+	// land on a draining node go to the algorithm's next candidate. If every
+	// node is draining, stateless mappers ignore the drain state. Re-adding
+	// a node with Add clears its draining state.
+	Drain(nodes ...string)
+
+	// PickIndex is like Pick but returns the ordinal of the chosen node in
+	// Nodes(), or -1 if no node could be chosen. Callers can use it to keep
+	// per-node state in slices instead of maps keyed by node ID.
+	PickIndex(key []byte) int
+
+	// Nodes returns a copy of the index -> node ID table used by PickIndex.
+	// Indices are stable until the next Add or Remove.
+	Nodes() []string
+}
+
+// CandidateWalker is implemented by mappers that can pick the best node for
+// a key while rejecting some nodes, falling through to the algorithm's own
+// next candidate (ring successor, next Maglev slot, next HRW rank, ...).
+// skip receives indices into Nodes() and must not call back into the
+// mapper. It returns -1 if every candidate is rejected; a nil skip behaves
+// like PickIndex. The key is a hash.Key so typed keys pass through without
+// conversion.
+type CandidateWalker interface {
+	PickIndexSkipping(key hash.Key, skip func(idx int) bool) int
+}
+
+// WeightedPicker is implemented by mappers whose choice depends on load
+// (CH-BL). PickIndexWeighted is PickIndex for a request of the given
+// weight, counted against the node's load instead of one key; size the
+// bound with Options.ExpectedWeight.
+type WeightedPicker interface {
+	PickIndexWeighted(key hash.Key, weight float64) int
+}
+
+// WeightedWalker is implemented by mappers that are both WeightedPicker
+// and CandidateWalker (CH-BL): PickIndexWeightedSkipping is
+// PickIndexWeighted that treats nodes rejected by skip as full. Overlays
+// use it to forward weighted picks.
+type WeightedWalker interface {
+	PickIndexWeightedSkipping(key hash.Key, weight float64, skip func(idx int) bool) int
+}
+
+// OverflowPicker is implemented by mappers whose PickIndexSkipping fails
+// when every acceptable node is at capacity (CH-BL). PickIndexOverflow
+// ignores capacity: it assigns a request of the given weight to the least
+// loaded node not rejected by skip, preferring non-draining nodes and
+// breaking ties in the key's ring order, and counts it there. It returns -1
+// only if skip rejects every node.
+type OverflowPicker interface {
+	PickIndexOverflow(key hash.Key, weight float64, skip func(idx int) bool) int
+}
+
+// LoadReleaser is implemented by mappers that track load (CH-BL).
+// ReleaseIndex removes a completed request of the given weight (1 for
+// PickIndex) from the load of node idx, so the bound applies to the
+// requests in flight rather than to every request ever picked.
+type LoadReleaser interface {
+	ReleaseIndex(idx int, weight float64)
+}
+
+// LoadResetter is implemented by mappers that track load (CH-BL).
+// ResetLoad forgets every assignment, as if the mapper were new, without
+// rebuilding it.
+type LoadResetter interface {
+	ResetLoad()
+}
+
+// Token is one point of a hash ring. Keys whose ring hash falls after the
+// previous token, up to and including Hash, start their lookup at the
+// node Nodes()[NodeIdx].
+type Token struct {
+	Hash    uint64
+	NodeIdx int
+}
+
+// TokenRing is implemented by ring-based mappers (ring, CH-BL). Tokens
+// returns a copy of the ring's tokens sorted by hash, and RingHash the
+// position on the ring at which a key's lookup starts.
+type TokenRing interface {
+	Tokens() []Token
+	RingHash(key hash.Key) uint64
+}
+
+// SlotTable is implemented by table-based mappers (Maglev). Slots returns
+// a copy of the lookup table, one index into Nodes() per slot, and Slot
+// the table slot a key hashes to.
+type SlotTable interface {
+	Slots() []int
+	Slot(key hash.Key) int
 }
 
 type Algo string
@@ -15,6 +117,7 @@ const (
 	AlgoMaglev Algo = "maglev"
 	AlgoCHBL   Algo = "chbl"
 	AlgoRing   Algo = "ring"
+	AlgoHRW    Algo = "hrw"
 )
 
 type Options struct {
@@ -30,6 +133,31 @@ type Options struct {
 	//
 	// For Jump and Maglev this field is ignored.
 	ExpectedKeys int
+
+	// ExpectedWeight is the expected total weight of the requests
+	// routed with WeightedPicker. When set, CH-BL bounds the weight per
+	// node, C = ceil(c * ExpectedWeight / numNodes), instead of the key
+	// count.
+	ExpectedWeight float64
+
+	// BoundInFlight makes CH-BL follow the load it currently carries
+	// instead of the expected total, as in the bounded-loads paper:
+	// C = ceil(c * (load + w) / numNodes) for a request of weight w.
+	// Callers release completed requests with LoadReleaser.
+	// ExpectedKeys and ExpectedWeight are then ignored.
+	BoundInFlight bool
+
+	// HashFunc names the hash function used for keys and node placement
+	// (see hash.ByName). Empty selects xxh64.
+	HashFunc string
+
+	// Topology holds optional zone/rack/host labels per node ID. It is
+	// only consulted by replica selection (PickN) on ring and HRW.
+	Topology Topology
+
+	// ReplicaSpread is the failure-domain level PickN spreads replicas
+	// across. DomainNone keeps plain preference order.
+	ReplicaSpread Domain
 }
 
 var ErrUnknownAlgo = errors.New("router: unknown algorithm")
@@ -0,0 +1,177 @@
+package workload
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Generator produces a synthetic request stream of n requests.
+type Generator interface {
+	Generate(n int, rng *rand.Rand) (*Trace, error)
+}
+
+// keyPicker returns a function drawing key indices in [0, keyspace):
+// uniformly if s == 0, otherwise Zipf-distributed with exponent s > 1
+// (index 0 most popular).
+func keyPicker(keyspace int, s float64, rng *rand.Rand) (func() int, error) {
+	if keyspace <= 0 {
+		return nil, fmt.Errorf("keyspace must be > 0, got %d", keyspace)
+	}
+	if s == 0 {
+		return func() int { return rng.Intn(keyspace) }, nil
+	}
+	if s <= 1 {
+		return nil, fmt.Errorf("zipf s must be 0 (uniform) or > 1, got %v", s)
+	}
+	z := rand.NewZipf(rng, s, 1, uint64(keyspace-1))
+	return func() int { return int(z.Uint64()) }, nil
+}
+
+func key(i int) []byte { return fmt.Appendf(nil, "key-%d", i) }
+
+// HotKeys sends Share of the requests in the window [Start, End) (fractions
+// of the stream) to Hot keys "hot-0".."hot-(Hot-1)"; every other request
+// draws from Keyspace keys, uniformly or Zipf with exponent S.
+type HotKeys struct {
+	Keyspace   int
+	S          float64
+	Hot        int
+	Share      float64
+	Start, End float64
+}
+
+func (g HotKeys) Generate(n int, rng *rand.Rand) (*Trace, error) {
+	if g.Hot <= 0 || g.Share < 0 || g.Share > 1 || g.Start < 0 || g.End > 1 || g.Start >= g.End {
+		return nil, errors.New("hot keys need hot > 0, 0 <= share <= 1 and 0 <= start < end <= 1")
+	}
+	pick, err := keyPicker(g.Keyspace, g.S, rng)
+	if err != nil {
+		return nil, err
+	}
+	t := &Trace{Keys: make([][]byte, n)}
+	for i := range t.Keys {
+		pos := float64(i) / float64(n)
+		if pos >= g.Start && pos < g.End && rng.Float64() < g.Share {
+			t.Keys[i] = fmt.Appendf(nil, "hot-%d", rng.Intn(g.Hot))
+		} else {
+			t.Keys[i] = key(pick())
+		}
+	}
+	return t, nil
+}
+
+// ShiftingZipf draws Zipf(S) popularity ranks over Keyspace keys and
+// rotates the rank-to-key mapping by Keyspace/Epochs at each of Epochs
+// equal slices of the stream, so the hot set moves over time.
+type ShiftingZipf struct {
+	Keyspace int
+	S        float64
+	Epochs   int
+}
+
+func (g ShiftingZipf) Generate(n int, rng *rand.Rand) (*Trace, error) {
+	if g.Epochs <= 0 {
+		return nil, errors.New("shifting zipf needs epochs > 0")
+	}
+	if g.S <= 1 {
+		return nil, fmt.Errorf("shifting zipf needs s > 1, got %v", g.S)
+	}
+	pick, err := keyPicker(g.Keyspace, g.S, rng)
+	if err != nil {
+		return nil, err
+	}
+	t := &Trace{Keys: make([][]byte, n)}
+	for i := range t.Keys {
+		epoch := i * g.Epochs / n
+		shift := epoch * (g.Keyspace / g.Epochs)
+		t.Keys[i] = key((pick() + shift) % g.Keyspace)
+	}
+	return t, nil
+}
+
+// ParetoSizes draws keys like HotKeys' background traffic and gives each
+// request a Pareto-distributed size (weight) with shape Alpha and minimum
+// Min; sizes have a finite mean only for Alpha > 1.
+type ParetoSizes struct {
+	Keyspace   int
+	S          float64
+	Alpha, Min float64
+}
+
+func (g ParetoSizes) Generate(n int, rng *rand.Rand) (*Trace, error) {
+	if g.Alpha <= 0 || g.Min <= 0 {
+		return nil, errors.New("pareto sizes need alpha > 0 and min > 0")
+	}
+	pick, err := keyPicker(g.Keyspace, g.S, rng)
+	if err != nil {
+		return nil, err
+	}
+	t := &Trace{Keys: make([][]byte, n), Weights: make([]float64, n)}
+	for i := range t.Keys {
+		t.Keys[i] = key(pick())
+		// inverse CDF; 1-Float64() is in (0, 1]
+		t.Weights[i] = g.Min / math.Pow(1-rng.Float64(), 1/g.Alpha)
+	}
+	return t, nil
+}
+
+// Scan requests key-Start, key-(Start+Stride), ... in order, wrapping
+// around Keyspace, like a range scan or sequential ID allocation.
+type Scan struct {
+	Keyspace      int
+	Start, Stride int
+}
+
+func (g Scan) Generate(n int, _ *rand.Rand) (*Trace, error) {
+	if g.Keyspace <= 0 || g.Stride <= 0 || g.Start < 0 {
+		return nil, errors.New("scan needs keyspace > 0, stride > 0 and start >= 0")
+	}
+	t := &Trace{Keys: make([][]byte, n)}
+	for i := range t.Keys {
+		t.Keys[i] = key((g.Start + i*g.Stride) % g.Keyspace)
+	}
+	return t, nil
+}
+
+// maxProbes bounds the candidate keys Adversarial tries per request.
+const maxProbes = 1 << 20
+
+// Adversarial sends Share of the requests to distinct keys "adv-N" for
+// which Collides returns true (typically: the key's home node is a chosen
+// victim); the rest draw uniformly from Keyspace keys.
+type Adversarial struct {
+	Keyspace int
+	Share    float64
+	Collides func(key []byte) bool
+}
+
+func (g Adversarial) Generate(n int, rng *rand.Rand) (*Trace, error) {
+	if g.Share < 0 || g.Share > 1 || g.Collides == nil {
+		return nil, errors.New("adversarial keys need 0 <= share <= 1 and a collision test")
+	}
+	pick, err := keyPicker(g.Keyspace, 0, rng)
+	if err != nil {
+		return nil, err
+	}
+	t := &Trace{Keys: make([][]byte, n)}
+	next := 0
+	for i := range t.Keys {
+		if rng.Float64() >= g.Share {
+			t.Keys[i] = key(pick())
+			continue
+		}
+		for probes := 0; t.Keys[i] == nil; probes++ {
+			if probes == maxProbes {
+				return nil, fmt.Errorf("no colliding key in %d candidates", maxProbes)
+			}
+			k := fmt.Appendf(nil, "adv-%d", next)
+			next++
+			if g.Collides(k) {
+				t.Keys[i] = k
+			}
+		}
+	}
+	return t, nil
+}
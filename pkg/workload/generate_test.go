@@ -0,0 +1,99 @@
+package workload
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestHotKeysWindow(t *testing.T) {
+	tr, err := HotKeys{Keyspace: 1000, Hot: 3, Share: 0.8, Start: 0.5, End: 1}.Generate(10000, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot := func(keys [][]byte) int {
+		c := 0
+		for _, k := range keys {
+			if bytes.HasPrefix(k, []byte("hot-")) {
+				c++
+			}
+		}
+		return c
+	}
+	if c := hot(tr.Keys[:5000]); c != 0 {
+		t.Fatalf("%d hot requests before the window", c)
+	}
+	if c := hot(tr.Keys[5000:]); c < 3800 || c > 4200 {
+		t.Fatalf("%d hot requests in the window, want about 4000", c)
+	}
+}
+
+func TestShiftingZipfMovesHotSet(t *testing.T) {
+	tr, err := ShiftingZipf{Keyspace: 1000, S: 2, Epochs: 2}.Generate(10000, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := func(keys [][]byte) string {
+		counts := map[string]int{}
+		best := ""
+		for _, k := range keys {
+			counts[string(k)]++
+			if counts[string(k)] > counts[best] {
+				best = string(k)
+			}
+		}
+		return best
+	}
+	if a, b := top(tr.Keys[:5000]), top(tr.Keys[5000:]); a != "key-0" || b != "key-500" {
+		t.Fatalf("most popular keys per epoch = %s, %s; want key-0, key-500", a, b)
+	}
+}
+
+func TestParetoSizes(t *testing.T) {
+	tr, err := ParetoSizes{Keyspace: 100, Alpha: 3, Min: 10}.Generate(100000, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for _, w := range tr.Weights {
+		if w < 10 {
+			t.Fatalf("size %v below the minimum", w)
+		}
+		sum += w
+	}
+	// mean of Pareto(alpha, min) is alpha*min/(alpha-1) = 15
+	if mean := sum / float64(len(tr.Weights)); mean < 14.5 || mean > 15.5 {
+		t.Fatalf("mean size %v, want about 15", mean)
+	}
+}
+
+func TestScan(t *testing.T) {
+	tr, err := Scan{Keyspace: 10, Start: 8, Stride: 1}.Generate(4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(bytes.Join(tr.Keys, []byte(" "))); got != "key-8 key-9 key-0 key-1" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestAdversarial(t *testing.T) {
+	collides := func(k []byte) bool { return strings.HasSuffix(string(k), "7") }
+	tr, err := Adversarial{Keyspace: 100, Share: 1, Collides: collides}.Generate(50, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, k := range tr.Keys {
+		if !collides(k) || seen[string(k)] {
+			t.Fatalf("key %s does not collide or repeats", k)
+		}
+		seen[string(k)] = true
+	}
+
+	never := func([]byte) bool { return false }
+	if _, err := (Adversarial{Keyspace: 100, Share: 1, Collides: never}).Generate(1, rand.New(rand.NewSource(1))); err == nil {
+		t.Fatal("expected an error when no key collides")
+	}
+}
@@ -0,0 +1,198 @@
+// Package workload provides request streams for the simulator: recorded
+// traces read from files and synthetic generators.
+package workload
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Trace formats reported in Trace.Format.
+const (
+	FormatLines = "lines" // one key per line
+	FormatCSV   = "csv"   // header row with a "key" column
+)
+
+// maxLine bounds the length of one line (key or CSV record).
+const maxLine = 1 << 20
+
+// Trace is a recorded request stream, one entry per request in arrival
+// order. The same key may appear many times.
+type Trace struct {
+	Format string
+	Keys   [][]byte
+	// Weights is the cost of each request (from a "weight" column, or
+	// "size" if there is none), or nil if the trace has neither.
+	Weights []float64
+	// Times is each request's timestamp in the trace's own unit, or nil
+	// if the trace has no timestamp column.
+	Times []float64
+}
+
+// Len returns the number of requests.
+func (t *Trace) Len() int { return len(t.Keys) }
+
+// LoadTrace reads a trace file; see ReadTrace.
+func LoadTrace(path string) (*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t, err := ReadTrace(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// ReadTrace reads a trace, gunzipping it first if it starts with the gzip
+// magic bytes. If the first non-empty line is a CSV header with a "key"
+// column, the input is CSV and the optional columns "timestamp" (or "ts",
+// "time"), "weight" and "size" are read too; otherwise every non-empty
+// line is one key.
+func ReadTrace(r io.Reader) (*Trace, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		br = bufio.NewReaderSize(zr, 64<<10)
+	}
+
+	sc := bufio.NewScanner(br)
+	sc.Buffer(make([]byte, 64<<10), maxLine)
+	line := 0
+	var first string
+	for sc.Scan() {
+		line++
+		if first = strings.TrimRight(sc.Text(), "\r"); strings.TrimSpace(first) != "" {
+			break
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	if strings.TrimSpace(first) == "" {
+		return nil, errors.New("empty trace")
+	}
+
+	var t *Trace
+	var err error
+	if cols, ok := csvHeader(first); ok {
+		t, err = readCSV(sc, cols, line)
+	} else {
+		t, err = readLines(sc, first, line)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Len() == 0 {
+		return nil, errors.New("trace has no requests")
+	}
+	return t, nil
+}
+
+// traceColumns holds the index of each recognised CSV column, or -1.
+type traceColumns struct {
+	n                       int
+	key, time, weight, size int
+}
+
+// csvHeader reports whether line is a CSV header naming a key column.
+func csvHeader(line string) (traceColumns, bool) {
+	cols := traceColumns{key: -1, time: -1, weight: -1, size: -1}
+	fields, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil || len(fields) < 2 {
+		return cols, false
+	}
+	cols.n = len(fields)
+	for i, f := range fields {
+		switch strings.ToLower(strings.TrimSpace(f)) {
+		case "key":
+			cols.key = i
+		case "timestamp", "ts", "time":
+			cols.time = i
+		case "weight":
+			cols.weight = i
+		case "size":
+			cols.size = i
+		}
+	}
+	return cols, cols.key >= 0
+}
+
+func readLines(sc *bufio.Scanner, first string, line int) (*Trace, error) {
+	t := &Trace{Format: FormatLines, Keys: [][]byte{[]byte(first)}}
+	for sc.Scan() {
+		line++
+		b := bytes.TrimRight(sc.Bytes(), "\r")
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		t.Keys = append(t.Keys, append([]byte(nil), b...))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return t, nil
+}
+
+func readCSV(sc *bufio.Scanner, cols traceColumns, line int) (*Trace, error) {
+	t := &Trace{Format: FormatCSV}
+	weightCol := cols.weight
+	if weightCol < 0 {
+		weightCol = cols.size
+	}
+
+	for sc.Scan() {
+		line++
+		text := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		rec, err := csv.NewReader(strings.NewReader(text)).Read()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(rec) != cols.n {
+			return nil, fmt.Errorf("line %d: %d fields, header has %d", line, len(rec), cols.n)
+		}
+		t.Keys = append(t.Keys, []byte(rec[cols.key]))
+		if cols.time >= 0 {
+			v, err := parseNumber(rec[cols.time])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: timestamp: %w", line, err)
+			}
+			t.Times = append(t.Times, v)
+		}
+		if weightCol >= 0 {
+			v, err := parseNumber(rec[weightCol])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: weight: %w", line, err)
+			}
+			if v < 0 {
+				return nil, fmt.Errorf("line %d: negative weight %v", line, v)
+			}
+			t.Weights = append(t.Weights, v)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return t, nil
+}
+
+func parseNumber(s string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
+}
@@ -0,0 +1,77 @@
+package workload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func TestReadTraceLines(t *testing.T) {
+	tr, err := ReadTrace(strings.NewReader("\nuser:1\r\nuser:2\n\nuser:1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Format != FormatLines || tr.Len() != 3 {
+		t.Fatalf("got format %q with %d requests, want lines with 3", tr.Format, tr.Len())
+	}
+	if string(tr.Keys[0]) != "user:1" || string(tr.Keys[2]) != "user:1" {
+		t.Fatalf("keys = %q", tr.Keys)
+	}
+	if tr.Weights != nil || tr.Times != nil {
+		t.Fatalf("line traces have no weights or times")
+	}
+}
+
+func TestReadTraceCSV(t *testing.T) {
+	in := "timestamp,key,size\n0.5,a,100\n1.25,\"b,c\",20\n"
+	tr, err := ReadTrace(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Format != FormatCSV || tr.Len() != 2 || string(tr.Keys[1]) != "b,c" {
+		t.Fatalf("got %q %q", tr.Format, tr.Keys)
+	}
+	if tr.Times[1] != 1.25 || tr.Weights[0] != 100 {
+		t.Fatalf("times %v weights %v", tr.Times, tr.Weights)
+	}
+
+	// An explicit weight column takes precedence over size.
+	tr, err = ReadTrace(strings.NewReader("key,size,weight\na,100,3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Weights[0] != 3 || tr.Times != nil {
+		t.Fatalf("weights %v times %v", tr.Weights, tr.Times)
+	}
+}
+
+func TestReadTraceGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("key,weight\nx,1\ny,2\n"))
+	zw.Close()
+
+	tr, err := ReadTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Len() != 2 || tr.Weights[1] != 2 {
+		t.Fatalf("got %q %v", tr.Keys, tr.Weights)
+	}
+}
+
+func TestReadTraceErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"\n\n",
+		"key,weight\n",
+		"key,weight\na,1,extra\n",
+		"key,weight\na,heavy\n",
+		"key,weight\na,-1\n",
+	} {
+		if _, err := ReadTrace(strings.NewReader(in)); err == nil {
+			t.Errorf("ReadTrace(%q) succeeded, want error", in)
+		}
+	}
+}
@@ -9,7 +9,8 @@ import re
 """
 This script reads simulator CSV output and produces:
 1. Per-node bar plot
-2. Summary comparison plots (CV vs algo, Max/Avg vs algo)
+2. Summary comparison plots (CV, Max/Avg, Gini, Jain's index and
+   KL divergence from uniform vs algo)
 
 Assumes CSV output of the form:
 
@@ -24,6 +25,9 @@ node-1,6401
 #mean,6250.0
 #max,7813
 #cv,0.04321
+#gini,0.02391
+#jain,0.99812
+...
 """
 
 def load_sim_csv(path):
@@ -73,7 +77,8 @@ def per_node_bar_plot(df, meta, outdir):
 
 def summary_line_plot(csv_paths, stat_key, outpath):
     """
-    stat_key: 'cv' or 'max'
+    stat_key: 'cv', 'max_over_avg' or any numeric summary row such as
+    'gini', 'jain' or 'kl_uniform'
     """
     records = []
 
@@ -90,14 +95,21 @@ def summary_line_plot(csv_paths, stat_key, outpath):
             y = cv
         elif stat_key == "max_over_avg":
             y = max_over_avg
+        elif stat_key in meta:
+            y = float(meta[stat_key])
         else:
-            raise ValueError("stat_key must be 'cv' or 'max_over_avg'")
+            # older CSVs predate the fairness rows
+            continue
 
         records.append({
             "algo": algo,
             "y": y
         })
 
+    if not records:
+        print(f"[SKIP] no '{stat_key}' rows in input")
+        return
+
     rec_df = pd.DataFrame(records).sort_values(by="algo")
 
     plt.figure(figsize=(8,5))
@@ -127,9 +139,11 @@ def main():
         df, meta = load_sim_csv(path)
         per_node_bar_plot(df, meta, args.outdir)
 
-    # Summary plots for CV and Max/Avg
+    # Summary plots for CV, Max/Avg and the fairness indices
     summary_line_plot(args.csv, "cv", os.path.join(args.outdir, "summary_cv_vs_algo.png"))
     summary_line_plot(args.csv, "max_over_avg", os.path.join(args.outdir, "summary_maxoveravg_vs_algo.png"))
+    for key in ("gini", "jain", "kl_uniform"):
+        summary_line_plot(args.csv, key, os.path.join(args.outdir, f"summary_{key}_vs_algo.png"))
 
 
 if __name__ == "__main__":
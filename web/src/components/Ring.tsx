@@ -96,6 +96,22 @@ const Ring: React.FC<RingProps> = ({ state, width, height, onNodeHover, onKeyHov
       '#00acc1', // Cyan
     ];
 
+    // Draw the real vnode tokens (ring/chbl) as ticks on the ring
+    (state.tokens ?? []).forEach((token) => {
+      const angle = token.position * 2 * Math.PI;
+      const nodeIdx = state.nodes.indexOf(token.node);
+      g.append('line')
+        .attr('x1', Math.cos(angle) * (radius - 6))
+        .attr('y1', Math.sin(angle) * (radius - 6))
+        .attr('x2', Math.cos(angle) * (radius + 6))
+        .attr('y2', Math.sin(angle) * (radius + 6))
+        .attr('stroke', nodeIdx >= 0 ? nodeColors[nodeIdx % nodeColors.length] : '#888')
+        .attr('stroke-width', 1.5)
+        .attr('opacity', 0.8)
+        .append('title')
+        .text(`${token.node} @ ${(token.position * 100).toFixed(2)}%`);
+    });
+
     // Draw nodes with better styling
     state.nodes.forEach((nodeId, idx) => {
       const angle = state.nodeAngles[nodeId] || (2 * Math.PI * idx / state.nodes.length);
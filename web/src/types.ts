@@ -7,6 +7,14 @@ export interface VisualizerState {
   algorithm: string;
   stats?: Statistics;
   chblConfig?: CHBLConfig;
+  tokens?: RingToken[]; // ring/chbl vnode tokens, in ring order
+}
+
+export interface RingToken {
+  hash: string; // uint64 as a decimal string
+  position: number; // 0..1 around the ring
+  node: string;
+  share: number; // fraction of the ring owned by this token
 }
 
 export interface CHBLConfig {